@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -16,11 +18,33 @@ var version = "0.0.0-dev"
 func Run() error {
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "config.yml", "config file path")
+	runCmd.Flags().StringVar(&logFormat, "log-format", "human", "log format (human, json)")
+	runCmd.Flags().StringVar(&reportJunit, "report-junit", "", "write a JUnit XML report of the run to this path")
+	runCmd.Flags().StringVar(&reportJson, "report-json", "", "write a JSON report of the run to this path")
+	runCmd.Flags().StringArrayVar(&varOverrides, "var", nil, "set a global var, taking precedence over setGlobalVar (name=value)")
+	runCmd.Flags().StringArrayVar(&envOverrides, "env", nil, "set an env var, taking precedence over setEnvVar (name=value)")
+	runCmd.Flags().StringArrayVar(&envFiles, "env-file", nil, "set env vars from a file of name=value lines")
+	defaultHelpFunc := runCmd.HelpFunc()
+	runCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		if help, ok := workflowHelp(cmd.Flags().Args()); ok {
+			fmt.Print(help)
+			return
+		}
+		defaultHelpFunc(cmd, args)
+	})
 	rootCmd.AddCommand(runCmd, encryptCmd, decryptCmd)
 	return rootCmd.Execute()
 }
 
-var configPath string
+var (
+	configPath   string
+	logFormat    string
+	reportJunit  string
+	reportJson   string
+	varOverrides []string
+	envOverrides []string
+	envFiles     []string
+)
 
 var rootCmd = &cobra.Command{
 	Use:           "autoshell",
@@ -41,7 +65,44 @@ var runCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return runner.New(cfg).RunWorkflow(args)
+		r := runner.New(cfg)
+		if err := r.SetLogFormat(logFormat); err != nil {
+			return err
+		}
+		for _, envFile := range envFiles {
+			if err := r.OverrideEnvFile(envFile); err != nil {
+				return err
+			}
+		}
+		for _, override := range envOverrides {
+			name, value, found := strings.Cut(override, "=")
+			if !found {
+				return fmt.Errorf("invalid env var override %q", override)
+			}
+			if err := r.OverrideEnvVar(name, value); err != nil {
+				return err
+			}
+		}
+		for _, override := range varOverrides {
+			name, value, found := strings.Cut(override, "=")
+			if !found {
+				return fmt.Errorf("invalid var override %q", override)
+			}
+			if err := r.OverrideVar(name, value); err != nil {
+				return err
+			}
+		}
+		if reportJunit != "" {
+			if err := r.AddReporter("junit", reportJunit); err != nil {
+				return err
+			}
+		}
+		if reportJson != "" {
+			if err := r.AddReporter("json", reportJson); err != nil {
+				return err
+			}
+		}
+		return r.RunWorkflow(args)
 	},
 }
 
@@ -75,6 +136,58 @@ var decryptCmd = &cobra.Command{
 	},
 }
 
+func workflowHelp(args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	cfg, err := config.Get(configPath, readPasswordOnce)
+	if err != nil {
+		return "", false
+	}
+	workflow, ok := cfg.Workflows[args[0]]
+	if !ok {
+		return "", false
+	}
+	help := new(strings.Builder)
+	fmt.Fprintf(help, "Usage:\n  autoshell run %s", args[0])
+	for _, param := range workflow.Params {
+		if param.Required {
+			fmt.Fprintf(help, " <%s>", param.Name)
+		} else {
+			fmt.Fprintf(help, " [%s]", param.Name)
+		}
+	}
+	help.WriteString(" [args...]\n")
+	if workflow.Description != "" {
+		fmt.Fprintf(help, "\n%s\n", workflow.Description)
+	}
+	if len(workflow.Params) > 0 {
+		help.WriteString("\nParams:\n")
+		tw := tabwriter.NewWriter(help, 0, 0, 2, ' ', 0)
+		for _, param := range workflow.Params {
+			var details []string
+			if param.Description != "" {
+				details = append(details, param.Description)
+			}
+			if param.Required {
+				details = append(details, "(required)")
+			}
+			if param.Default != "" {
+				details = append(details, fmt.Sprintf("(default %q)", param.Default))
+			}
+			if len(param.Allowed) > 0 {
+				details = append(details, "(allowed: "+strings.Join(param.Allowed, ", ")+")")
+			}
+			if param.Regex != "" {
+				details = append(details, fmt.Sprintf("(pattern %q)", param.Regex))
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", param.Name, strings.Join(details, " "))
+		}
+		_ = tw.Flush()
+	}
+	return help.String(), true
+}
+
 func readPasswordOnce() (string, error) {
 	return readPassword(false)
 }
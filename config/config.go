@@ -1,12 +1,14 @@
 package config
 
 import (
+	"autoshell/fileutil"
 	"bytes"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
 	"strings"
@@ -14,7 +16,10 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-const devicePassVar = "$DP"
+const (
+	devicePassVar = "$DP"
+	filePerm      = 0o600
+)
 
 var (
 	magicBytes        = []byte{0x17, 0x6F, 0x95, 0xF3, 0xF3, 0x81, 0x32, 0x6F}
@@ -23,8 +28,55 @@ var (
 )
 
 type Config struct {
-	Protected bool              `yaml:"protected"`
-	Workflows map[string]string `yaml:"workflows"`
+	Protected  bool                `yaml:"protected"`
+	LockedVars []string            `yaml:"lockedVars"`
+	Workflows  map[string]Workflow `yaml:"workflows"`
+}
+
+type Workflow struct {
+	Description  string  `yaml:"description"`
+	Params       []Param `yaml:"params"`
+	Instructions string  `yaml:"instructions"`
+}
+
+type Param struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required"`
+	Default     string   `yaml:"default"`
+	Allowed     []string `yaml:"allowed"`
+	Regex       string   `yaml:"regex"`
+}
+
+func (w *Workflow) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&w.Instructions)
+	}
+	type rawWorkflow Workflow
+	if err := value.Decode((*rawWorkflow)(w)); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, param := range w.Params {
+		if param.Name == "" {
+			return fmt.Errorf("line %d: param name is empty", value.Line)
+		}
+		if names[param.Name] {
+			return fmt.Errorf("line %d: duplicate param %q", value.Line, param.Name)
+		}
+		names[param.Name] = true
+		if _, err := param.Matches(""); err != nil {
+			return fmt.Errorf("line %d: param %q: %w", value.Line, param.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p Param) Matches(value string) (bool, error) {
+	if p.Regex == "" {
+		return true, nil
+	}
+	return regexp.MatchString("^(?:"+p.Regex+")$", value)
 }
 
 type GetPassword func() (string, error)
@@ -137,7 +189,7 @@ func Encrypt(filePath string, getPassword GetPassword) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("encrypt: %w", err)
 	}
-	if err := atomicWrite(r.filePath, func(file *os.File) error {
+	if err := fileutil.AtomicWrite(r.filePath, filePerm, func(file *os.File) error {
 		_, err := file.Write(slices.Concat(magicBytes, devicePassSalt, payload))
 		return err
 	}); err != nil {
@@ -172,7 +224,7 @@ func Decrypt(filePath string, getPassword GetPassword) error {
 			return fmt.Errorf("file is protected and the password contains %q", devicePassVar)
 		}
 	}
-	if err := atomicWrite(r.filePath, func(file *os.File) error {
+	if err := fileutil.AtomicWrite(r.filePath, filePerm, func(file *os.File) error {
 		_, err := file.Write(r.configBytes)
 		return err
 	}); err != nil {
@@ -193,46 +245,3 @@ func readPassword(getPassword GetPassword, devicePass string) (string, bool, err
 	}
 	return password, devicePassVarUsed, nil
 }
-
-const (
-	dirPerm  = 0o700
-	filePerm = 0o600
-)
-
-func atomicWrite(filePath string, write func(file *os.File) error) error {
-	dirPath := filepath.Dir(filePath)
-	if err := os.MkdirAll(dirPath, dirPerm); err != nil {
-		return fmt.Errorf("mkdir: %w", err)
-	}
-	tmpFile, err := os.CreateTemp(dirPath, filepath.Base(filePath)+".tmp-*")
-	if err != nil {
-		return fmt.Errorf("create: %w", err)
-	}
-	tmpFilePath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpFilePath)
-		}
-	}()
-	if err := tmpFile.Chmod(filePerm); err != nil {
-		_ = tmpFile.Close()
-		return fmt.Errorf("chmod: %w", err)
-	}
-	if err := write(tmpFile); err != nil {
-		_ = tmpFile.Close()
-		return fmt.Errorf("write: %w", err)
-	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return fmt.Errorf("sync: %w", err)
-	}
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("close: %w", err)
-	}
-	if err := os.Rename(tmpFilePath, filePath); err != nil {
-		return fmt.Errorf("rename: %w", err)
-	}
-	cleanup = false
-	return nil
-}
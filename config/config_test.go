@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestUnmarshalWorkflows(t *testing.T) {
+	var config Config
+	data := `
+workflows:
+  main: |-
+    print hi
+  restic:
+    description: Run restic
+    params:
+      - name: destination
+        required: true
+    instructions: print $destination
+`
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if config.Workflows["main"].Instructions != "print hi" {
+		t.Errorf("unexpected instructions %q", config.Workflows["main"].Instructions)
+	}
+	if restic := config.Workflows["restic"]; len(restic.Params) != 1 || !restic.Params[0].Required || restic.Instructions != "print $destination" {
+		t.Errorf("unexpected workflow %+v", restic)
+	}
+	for _, data := range []string{
+		"workflows: {main: {params: [{name: ''}]}}",
+		"workflows: {main: {params: [{name: a}, {name: a}]}}",
+		"workflows: {main: {params: [{name: a, regex: '['}]}}",
+	} {
+		if err := yaml.Unmarshal([]byte(data), &config); err == nil {
+			t.Errorf("expected %q to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+func (r *Runner) builtinVar(name string, s *scope) (string, bool) {
+	switch name {
+	case "now":
+		return time.Now().Format(time.RFC3339), true
+	case "hostname":
+		hostname, _ := os.Hostname()
+		return hostname, true
+	case "workflow":
+		return r.workflow, true
+	case "runId":
+		return r.runId, true
+	case "os":
+		return runtime.GOOS, true
+	case "arch":
+		return runtime.GOARCH, true
+	case "uuid":
+		return newUuid(), true
+	case "workDir":
+		return s.workDir(), true
+	}
+	return "", false
+}
+
+func (r *Runner) builtinFuncs(s *scope) map[string]func(arg string) (string, error) {
+	return map[string]func(arg string) (string, error){
+		"now": func(layout string) (string, error) {
+			return time.Now().Format(layout), nil
+		},
+		"env": func(name string) (string, error) {
+			value, _ := r.lookupEnv(name, s.env)
+			return value, nil
+		},
+		"file": func(path string) (string, error) {
+			return readValueFile(s.resolvePath(path))
+		},
+		"sha256": func(value string) (string, error) {
+			sum := sha256.Sum256([]byte(value))
+			return hex.EncodeToString(sum[:]), nil
+		},
+	}
+}
+
+func newUuid() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,265 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	notifyAlways  = "always"
+	notifyFailure = "failure"
+	notifyChange  = "change"
+)
+
+const (
+	runStateOk     = "ok"
+	runStateFailed = "failed"
+)
+
+const discordMaxContentLen = 2000
+
+type chatReporter struct {
+	kind      string
+	endpoint  string
+	notify    *notifyPolicy
+	transport *reporterTransport
+}
+
+type chatMessage struct {
+	title  string
+	body   string
+	failed bool
+}
+
+func newChatReporter(kind string, endpoint string, modifiers map[string]string, transport *reporterTransport) (reporter, error) {
+	notify, err := newNotifyPolicy(kind, endpoint, modifiers)
+	if err != nil {
+		return nil, err
+	}
+	return &chatReporter{
+		kind:      kind,
+		endpoint:  endpoint,
+		notify:    notify,
+		transport: transport,
+	}, nil
+}
+
+func (c *chatReporter) start() error {
+	return nil
+}
+
+func (c *chatReporter) end(result runResult) error {
+	shouldNotify, recovered, err := c.notify.check(result)
+	if err != nil {
+		return err
+	}
+	if shouldNotify {
+		req, err := c.newRequest(formatChatMessage(result, recovered))
+		if err != nil {
+			return err
+		}
+		if err := c.transport.send(req); err != nil {
+			return err
+		}
+	}
+	return c.notify.save(result)
+}
+
+type notifyPolicy struct {
+	conditions    []string
+	stateFilePath string
+}
+
+func newNotifyPolicy(kind string, endpoint string, modifiers map[string]string) (*notifyPolicy, error) {
+	conditions := []string{notifyAlways}
+	if notifyStr, ok := modifiers["notify"]; ok {
+		conditions = strings.Split(notifyStr, "|")
+		for _, condition := range conditions {
+			if condition != notifyAlways && condition != notifyFailure && condition != notifyChange {
+				return nil, fmt.Errorf("invalid notify condition %q", condition)
+			}
+		}
+	}
+	stateFilePath := modifiers["stateFile"]
+	if stateFilePath == "" && slices.Contains(conditions, notifyChange) {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("get cache dir: %w", err)
+		}
+		hash := sha256.Sum256([]byte(kind + "\n" + endpoint))
+		stateFilePath = filepath.Join(cacheDir, "autoshell", "reporter-"+hex.EncodeToString(hash[:8])+".json")
+	}
+	return &notifyPolicy{conditions: conditions, stateFilePath: stateFilePath}, nil
+}
+
+func (n *notifyPolicy) check(result runResult) (bool, bool, error) {
+	failed := len(result.errMsgs) > 0
+	state := runState(result)
+	var prevState string
+	if n.stateFilePath != "" {
+		states, err := n.readStates()
+		if err != nil {
+			return false, false, fmt.Errorf("read state: %w", err)
+		}
+		prevState = states[runStateKey(result)]
+	}
+	changed := prevState != state && (prevState != "" || failed)
+	var shouldNotify bool
+	for _, condition := range n.conditions {
+		switch condition {
+		case notifyAlways:
+			shouldNotify = true
+		case notifyFailure:
+			shouldNotify = shouldNotify || failed
+		case notifyChange:
+			shouldNotify = shouldNotify || changed
+		}
+	}
+	return shouldNotify, prevState == runStateFailed && !failed, nil
+}
+
+func (n *notifyPolicy) save(result runResult) error {
+	if n.stateFilePath == "" {
+		return nil
+	}
+	states, err := n.readStates()
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	states[runStateKey(result)] = runState(result)
+	if err = n.writeStates(states); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+func runState(result runResult) string {
+	if len(result.errMsgs) > 0 {
+		return runStateFailed
+	}
+	return runStateOk
+}
+
+func runStateKey(result runResult) string {
+	if result.command != "" {
+		return result.workflow + "/" + result.command
+	}
+	return result.workflow
+}
+
+func (n *notifyPolicy) readStates() (map[string]string, error) {
+	states := make(map[string]string)
+	data, err := os.ReadFile(n.stateFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return states, nil
+}
+
+func (n *notifyPolicy) writeStates(states map[string]string) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(n.stateFilePath), 0o700); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	return os.WriteFile(n.stateFilePath, data, 0o600)
+}
+
+func (c *chatReporter) newRequest(message chatMessage) (*http.Request, error) {
+	switch c.kind {
+	case "slack":
+		return newJsonRequest(c.endpoint, map[string]any{"text": "*" + message.title + "*\n" + message.body})
+	case "discord":
+		content := "**" + message.title + "**\n" + message.body
+		if runes := []rune(content); len(runes) > discordMaxContentLen {
+			content = string(runes[:discordMaxContentLen-3]) + "..."
+		}
+		return newJsonRequest(c.endpoint, map[string]any{"content": content})
+	case "ntfy":
+		req, err := newRequest(http.MethodPost, c.endpoint, "text/plain; charset=utf-8", message.body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Title", message.title)
+		if message.failed {
+			req.Header.Set("Priority", "high")
+			req.Header.Set("Tags", "x")
+		} else {
+			req.Header.Set("Tags", "white_check_mark")
+		}
+		return req, nil
+	case "gotify":
+		priority := 5
+		if message.failed {
+			priority = 8
+		}
+		return newJsonRequest(c.endpoint, map[string]any{"title": message.title, "message": message.body, "priority": priority})
+	default:
+		return nil, errors.New("invalid kind")
+	}
+}
+
+func newJsonRequest(endpoint string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+	return newRequest(http.MethodPost, endpoint, "application/json", string(body))
+}
+
+func formatChatMessage(result runResult, recovered bool) chatMessage {
+	failed := len(result.errMsgs) > 0
+	var status string
+	switch {
+	case failed:
+		status = "failed"
+	case recovered:
+		status = "recovered"
+	default:
+		status = "succeeded"
+	}
+	name := result.workflow
+	if result.command != "" {
+		name += "/" + result.command
+	}
+	title := fmt.Sprintf("autoshell: %s %s", name, status)
+	if hostname, err := os.Hostname(); err == nil {
+		title += " on " + hostname
+	}
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "Duration: %s", result.elapsed.Round(time.Millisecond))
+	var failedCommands []commandResult
+	for _, command := range result.commands {
+		if command.failed() {
+			failedCommands = append(failedCommands, command)
+		}
+	}
+	if len(failedCommands) > 0 {
+		body.WriteString("\nFailed commands:")
+		for _, command := range failedCommands {
+			fmt.Fprintf(body, "\n- %s (%s, exit code %d)", command.id, command.duration.Round(time.Millisecond), command.exitCode)
+		}
+	}
+	if result.err != nil {
+		fmt.Fprintf(body, "\nError: %s", result.err)
+	}
+	return chatMessage{title: title, body: body.String(), failed: failed}
+}
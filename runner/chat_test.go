@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeChatRequest struct {
+	header http.Header
+	body   string
+}
+
+func newFakeChatServer(t *testing.T, status *int) (*httptest.Server, *[]fakeChatRequest) {
+	t.Helper()
+	var requests []fakeChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, fakeChatRequest{header: req.Header, body: string(body)})
+		if status != nil {
+			w.WriteHeader(*status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestChatReporter(t *testing.T) {
+	success := runResult{workflow: "backup", elapsed: 1500 * time.Millisecond}
+	failure := runResult{
+		workflow: "backup",
+		elapsed:  2 * time.Second,
+		errMsgs:  []string{"Failed commands: b2-backup-db"},
+		commands: []commandResult{
+			{id: "create-sql-dump", status: commandStatusOk, attempts: 1},
+			{id: "b2-backup-db", status: commandStatusFailed, attempts: 1, exitCode: 3, duration: time.Second},
+		},
+	}
+	t.Run("Payloads", func(t *testing.T) {
+		server, requests := newFakeChatServer(t, nil)
+		for _, kind := range []string{"slack", "discord", "ntfy", "gotify"} {
+			entry, err := newReporterEntry(kind, server.URL, map[string]string{})
+			if err != nil {
+				t.Fatalf("new reporter: %v", err)
+			}
+			if err := entry.end(failure); err != nil {
+				t.Fatalf("end %s: %v", kind, err)
+			}
+		}
+		if len(*requests) != 4 {
+			t.Fatalf("expected 4 requests, got %d", len(*requests))
+		}
+		title := "autoshell: backup failed"
+		body := "Duration: 2s\nFailed commands:\n- b2-backup-db (1s, exit code 3)"
+		var slack, discord, gotify map[string]any
+		for i, payload := range map[int]*map[string]any{0: &slack, 1: &discord, 3: &gotify} {
+			if err := json.Unmarshal([]byte((*requests)[i].body), payload); err != nil {
+				t.Fatalf("unmarshal payload: %v", err)
+			}
+		}
+		if text, _ := slack["text"].(string); !strings.HasPrefix(text, "*"+title) || !strings.HasSuffix(text, "*\n"+body) {
+			t.Errorf("unexpected slack payload %v", slack)
+		}
+		if content, _ := discord["content"].(string); !strings.HasPrefix(content, "**"+title) || !strings.HasSuffix(content, "**\n"+body) {
+			t.Errorf("unexpected discord payload %v", discord)
+		}
+		if ntfy := (*requests)[2]; !strings.HasPrefix(ntfy.header.Get("Title"), title) || ntfy.header.Get("Priority") != "high" || ntfy.header.Get("Tags") != "x" || ntfy.body != body {
+			t.Errorf("unexpected ntfy request %+v", ntfy)
+		}
+		if gotifyTitle, _ := gotify["title"].(string); !strings.HasPrefix(gotifyTitle, title) || gotify["message"] != body || gotify["priority"] != float64(8) {
+			t.Errorf("unexpected gotify payload %v", gotify)
+		}
+	})
+	t.Run("Notify Conditions", func(t *testing.T) {
+		server, requests := newFakeChatServer(t, nil)
+		for _, tc := range []struct {
+			notify   string
+			runs     []runResult
+			expected []string
+		}{
+			{"always", []runResult{success, success}, []string{"succeeded", "succeeded"}},
+			{"failure", []runResult{success, failure, failure}, []string{"failed", "failed"}},
+			{"change", []runResult{success, failure, failure, success, success}, []string{"failed", "recovered"}},
+			{"failure|change", []runResult{failure, failure, success}, []string{"failed", "failed", "recovered"}},
+		} {
+			*requests = nil
+			modifiers := map[string]string{"notify": tc.notify, "stateFile": filepath.Join(t.TempDir(), "state.json")}
+			for _, result := range tc.runs {
+				entry, err := newReporterEntry("ntfy", server.URL, modifiers)
+				if err != nil {
+					t.Fatalf("new reporter: %v", err)
+				}
+				if err := entry.end(result); err != nil {
+					t.Fatalf("end: %v", err)
+				}
+			}
+			var statuses []string
+			for _, request := range *requests {
+				fields := strings.Fields(request.header.Get("Title"))
+				statuses = append(statuses, fields[2])
+			}
+			if strings.Join(statuses, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected notify=%s to send %q, got %q", tc.notify, tc.expected, statuses)
+			}
+		}
+	})
+	t.Run("State Not Saved On Send Failure", func(t *testing.T) {
+		status := http.StatusBadRequest
+		server, requests := newFakeChatServer(t, &status)
+		modifiers := map[string]string{"notify": "change", "stateFile": filepath.Join(t.TempDir(), "state.json")}
+		entry, err := newReporterEntry("slack", server.URL, modifiers)
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(failure); err == nil {
+			t.Fatal("expected send to fail")
+		}
+		status = http.StatusOK
+		if err := entry.end(failure); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if len(*requests) != 2 {
+			t.Errorf("expected failure to be reported again after a failed send, got %d requests", len(*requests))
+		}
+		if err := entry.end(failure); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if len(*requests) != 2 {
+			t.Errorf("expected unchanged failure not to be reported, got %d requests", len(*requests))
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+type commandOptions struct {
+	env        map[string]string
+	dir        string
+	stdin      func() (io.ReadCloser, error)
+	stdoutFile string
+	stderrFile string
+	appendMode bool
+}
+
+func (r *Runner) commandOptions(s *scope, args []string, modifiers map[string]string) (commandOptions, []string, error) {
+	options := commandOptions{env: r.commandEnv(s.env, modifiers), dir: s.workDir()}
+	if dir, ok := modifiers["dir"]; ok {
+		var err error
+		if options.dir, err = s.resolveDir(dir); err != nil {
+			return commandOptions{}, nil, err
+		}
+	}
+	stdinModifiers := 0
+	for _, name := range []string{"stdin", "stdinFile", "stdinVar"} {
+		if _, ok := modifiers[name]; ok {
+			stdinModifiers++
+		}
+	}
+	if stdinModifiers > 1 {
+		return commandOptions{}, nil, errors.New("only one of stdin, stdinFile and stdinVar can be set")
+	}
+	var data string
+	if modifiers["stdin"] == "true" && len(args) > 0 {
+		data = args[len(args)-1]
+		args = args[:len(args)-1]
+		options.stdin = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(data)), nil }
+	}
+	if name, ok := modifiers["stdinVar"]; ok {
+		var found bool
+		if data, found = s.vars[name]; !found {
+			if data, found = r.vars[name]; !found {
+				return commandOptions{}, nil, fmt.Errorf("variable %q not set", name)
+			}
+		}
+		options.stdin = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(data)), nil }
+	}
+	if path, ok := modifiers["stdinFile"]; ok {
+		path = s.resolvePath(path)
+		options.stdin = func() (io.ReadCloser, error) { return os.Open(path) } //nolint:gosec
+	}
+	if path, ok := modifiers["stdoutFile"]; ok {
+		options.stdoutFile = s.resolvePath(path)
+	}
+	if path, ok := modifiers["stderrFile"]; ok {
+		options.stderrFile = s.resolvePath(path)
+	}
+	options.appendMode = modifiers["append"] == "true"
+	return options, args, nil
+}
+
+func (options commandOptions) withStdio(run func(stdio commandIO) error) func(stdio commandIO) error {
+	if options.stdin == nil && options.stdoutFile == "" && options.stderrFile == "" {
+		return run
+	}
+	return func(stdio commandIO) (err error) {
+		if options.stdin != nil {
+			var stdin io.ReadCloser
+			if stdin, err = options.stdin(); err != nil {
+				return fmt.Errorf("open stdin: %w", err)
+			}
+			defer stdin.Close()
+			stdio.stdin = stdin
+		}
+		var stdout *outputFile
+		if options.stdoutFile != "" {
+			if stdout, err = openOutputFile(options.stdoutFile, options.appendMode); err != nil {
+				return fmt.Errorf("open stdout file: %w", err)
+			}
+			defer func() {
+				if closeErr := stdout.Close(); closeErr != nil && err == nil {
+					err = fmt.Errorf("close stdout file: %w", closeErr)
+				}
+			}()
+			stdio.stdout = stdout.writer()
+		}
+		if options.stderrFile != "" && options.stderrFile == options.stdoutFile {
+			stdio.stderr = io.MultiWriter(stdout.writer(), stdio.stderr)
+		} else if options.stderrFile != "" {
+			var stderr *outputFile
+			if stderr, err = openOutputFile(options.stderrFile, options.appendMode); err != nil {
+				return fmt.Errorf("open stderr file: %w", err)
+			}
+			defer func() {
+				if closeErr := stderr.Close(); closeErr != nil && err == nil {
+					err = fmt.Errorf("close stderr file: %w", closeErr)
+				}
+			}()
+			stdio.stderr = io.MultiWriter(stderr.writer(), stdio.stderr)
+		}
+		return run(stdio)
+	}
+}
+
+type commandIO struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (r *Runner) runCommand(action string, commandId string, modifiers map[string]string, run func(stdio commandIO) error) {
+	retries := 0
+	if retriesStr, ok := modifiers["retries"]; ok {
+		retries, _ = strconv.Atoi(retriesStr)
+	}
+	commandStart := time.Now()
+	logTailOffset := r.logTail.Len()
+	r.startCommandReporters(commandId)
+	var cmdErr error
+	var exitCode int
+	status := commandStatusOk
+	attempt := 0
+	for i := 0; i <= retries; i++ {
+		attempt = i + 1
+		startEvent := logEvent{Event: eventCommandStart, CommandId: commandId, Attempt: attempt}
+		if i > 0 {
+			startEvent.Message = fmt.Sprintf("Retrying (%d/%d)", i, retries)
+		} else if modifiers["hideCommandId"] != "true" {
+			startEvent.Message = "Command ID: " + commandId
+		}
+		r.logEvent(startEvent)
+		attemptStart := time.Now()
+		r.log("")
+		stdio := commandIO{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+		var stdout, stderr *outputWriter
+		if r.capturesOutput() {
+			stdout = r.newOutputWriter(commandId, attempt, streamStdout)
+			stderr = r.newOutputWriter(commandId, attempt, streamStderr)
+			stdio = commandIO{stdout: stdout, stderr: stderr}
+			if r.logFile == nil || term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec
+				stdio.stdin = os.Stdin
+			}
+		}
+		cmdErr = run(stdio)
+		if stdout != nil {
+			stdout.Flush()
+			stderr.Flush()
+		}
+		exitCode = 0
+		var ignored bool
+		if cmdErr != nil {
+			var isExitCode bool
+			exitCode, isExitCode = exitCodeOf(cmdErr)
+			ignored = isExitCode && slices.Contains(r.ignoredExitCodes, exitCode)
+		}
+		endEvent := logEvent{
+			Event:      eventCommandEnd,
+			CommandId:  commandId,
+			Attempt:    attempt,
+			ExitCode:   new(exitCode),
+			DurationMs: new(time.Since(attemptStart).Milliseconds()),
+		}
+		if cmdErr != nil && !ignored {
+			endEvent.Level = levelError
+			endEvent.Message = fmt.Sprintf("%s failed: %s", action, cmdErr)
+		}
+		r.logEvent(endEvent)
+		if cmdErr == nil || ignored {
+			if ignored {
+				status = commandStatusIgnored
+			} else if i > 0 {
+				status = commandStatusRetried
+			}
+			break
+		}
+		if i < retries {
+			continue
+		}
+		status = commandStatusIgnored
+		if modifiers["ignoreFailures"] != "true" {
+			status = commandStatusFailed
+			r.failedCommands = append(r.failedCommands, commandId)
+			if _, ok := exitCodeOf(cmdErr); ok {
+				r.lastFailedExitCode = exitCode
+			}
+		}
+	}
+	result := commandResult{
+		id:       commandId,
+		status:   status,
+		attempts: attempt,
+		duration: time.Since(commandStart),
+		exitCode: exitCode,
+	}
+	output := r.logTail.Since(logTailOffset)
+	if status == commandStatusFailed || status == commandStatusIgnored {
+		result.output = output
+	}
+	r.commandResults = append(r.commandResults, result)
+	r.reportCommand(result, cmdErr, output)
+}
+
+func exitCodeOf(err error) (int, bool) {
+	if exitError, ok := errors.AsType[*exec.ExitError](err); ok {
+		return exitError.ExitCode(), true
+	}
+	if exitStatus, ok := errors.AsType[interp.ExitStatus](err); ok {
+		return int(exitStatus), true
+	}
+	return -1, false
+}
+
+func execCommand(name string, args []string, options commandOptions) func(stdio commandIO) error {
+	return func(stdio commandIO) error {
+		cmd := exec.Command(lookPath(name, options.env), args...) //nolint:gosec
+		cmd.Args[0] = name
+		cmd.Env = formatEnv(options.env)
+		cmd.Dir = options.dir
+		cmd.Stdin = stdio.stdin
+		cmd.Stdout = stdio.stdout
+		cmd.Stderr = stdio.stderr
+		return cmd.Run()
+	}
+}
+
+func shellCommand(commandId string, script string, options commandOptions) (func(stdio commandIO) error, error) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), commandId)
+	if err != nil {
+		return nil, fmt.Errorf("parse script: %w", err)
+	}
+	return func(stdio commandIO) error {
+		shell, err := interp.New(
+			interp.Env(expand.ListEnviron(formatEnv(options.env)...)),
+			interp.Dir(options.dir),
+			interp.StdIO(stdio.stdin, stdio.stdout, stdio.stderr),
+		)
+		if err != nil {
+			return err
+		}
+		return shell.Run(context.Background(), file)
+	}, nil
+}
+
+type pipelineError struct {
+	exitCodes []int
+	err       error
+}
+
+func (e *pipelineError) Error() string {
+	exitCodes := make([]string, len(e.exitCodes))
+	for i, exitCode := range e.exitCodes {
+		exitCodes[i] = strconv.Itoa(exitCode)
+	}
+	return fmt.Sprintf("%s (exit codes: %s)", e.err, strings.Join(exitCodes, " | "))
+}
+
+func (e *pipelineError) Unwrap() error {
+	return e.err
+}
+
+func splitPipeline(args []string) ([][]string, error) {
+	var stages [][]string
+	start := 0
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && args[i] != "|" {
+			continue
+		}
+		if i == start {
+			return nil, errors.New("empty pipeline stage")
+		}
+		stages = append(stages, args[start:i])
+		start = i + 1
+	}
+	return stages, nil
+}
+
+func pipelineCommand(stages [][]string, options commandOptions) func(stdio commandIO) error {
+	return func(stdio commandIO) error {
+		cmds := make([]*exec.Cmd, len(stages))
+		var pipeFiles []*os.File
+		closePipes := func() {
+			for _, file := range pipeFiles {
+				_ = file.Close()
+			}
+			pipeFiles = nil
+		}
+		for i, stage := range stages {
+			cmd := exec.Command(lookPath(stage[0], options.env), stage[1:]...) //nolint:gosec
+			cmd.Args[0] = stage[0]
+			cmd.Env = formatEnv(options.env)
+			cmd.Dir = options.dir
+			cmd.Stderr = stdio.stderr
+			if i == 0 {
+				cmd.Stdin = stdio.stdin
+			} else {
+				pipeReader, pipeWriter, err := os.Pipe()
+				if err != nil {
+					closePipes()
+					return fmt.Errorf("create pipe: %w", err)
+				}
+				pipeFiles = append(pipeFiles, pipeReader, pipeWriter)
+				cmds[i-1].Stdout = pipeWriter
+				cmd.Stdin = pipeReader
+			}
+			cmds[i] = cmd
+		}
+		cmds[len(cmds)-1].Stdout = stdio.stdout
+		for i, cmd := range cmds {
+			if err := cmd.Start(); err != nil {
+				closePipes()
+				for _, started := range cmds[:i] {
+					_ = started.Process.Kill()
+					_ = started.Wait()
+				}
+				return fmt.Errorf("stage %d: %w", i+1, err)
+			}
+		}
+		closePipes()
+		exitCodes := make([]int, len(cmds))
+		var lastErr error
+		for i, cmd := range cmds {
+			if err := cmd.Wait(); err != nil {
+				exitCodes[i], _ = exitCodeOf(err)
+				lastErr = fmt.Errorf("stage %d (%s): %w", i+1, stages[i][0], err)
+			}
+		}
+		if lastErr != nil {
+			return &pipelineError{exitCodes: exitCodes, err: lastErr}
+		}
+		return nil
+	}
+}
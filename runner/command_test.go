@@ -0,0 +1,211 @@
+package runner
+
+import (
+	"autoshell/config"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRunShell(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setEnvVar AUTOSHELL_TEST_DIR " + filepath.ToSlash(dir),
+			"setIgnoredExitCodes [3]",
+			`runShell glob 'cd "$AUTOSHELL_TEST_DIR" && echo glob *.txt'`,
+			"runShell pipe <<'EOF'",
+			`echo one two | while read a b; do echo "pipe $b" > "$AUTOSHELL_TEST_DIR/out"; done`,
+			`read line < "$AUTOSHELL_TEST_DIR/out" && echo "read $line"`,
+			"EOF",
+			"runShell vars 'name=world; echo \"hello $$name\"; false; echo \"status $?\"'",
+			"runShell stderr 'for i in 1 2 3 4 5; do echo left $$i >&2; done | for i in 1 2 3 4 5; do echo right $$i >&2; done'",
+			"runShell ignored 'exit 3'",
+			"runShell!retries=1 failed 'echo attempt >&2; exit 4'",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Fatal("expected workflow to fail")
+	}
+	log := r.logTail.String()
+	for _, expected := range []string{"glob a.txt b.txt\n", "read pipe two\n", "hello world\nstatus 1\n", "left 5\n", "right 5\n", "runShell failed: exit status 4\n"} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, log)
+		}
+	}
+	expected := []commandResult{
+		{id: "glob", status: commandStatusOk, attempts: 1},
+		{id: "pipe", status: commandStatusOk, attempts: 1},
+		{id: "vars", status: commandStatusOk, attempts: 1},
+		{id: "stderr", status: commandStatusOk, attempts: 1},
+		{id: "ignored", status: commandStatusIgnored, attempts: 1, exitCode: 3},
+		{id: "failed", status: commandStatusFailed, attempts: 2, exitCode: 4},
+	}
+	if len(r.commandResults) != len(expected) {
+		t.Fatalf("expected %d command results, got %d", len(expected), len(r.commandResults))
+	}
+	for i, result := range r.commandResults {
+		result.duration = 0
+		result.output = ""
+		if result != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], result)
+		}
+	}
+	if r.lastFailedExitCode != 4 {
+		t.Errorf("expected exit code 4, got %d", r.lastFailedExitCode)
+	}
+	r = New(config.Config{Workflows: map[string]config.Workflow{"main": {Instructions: "runShell invalid 'echo ('"}}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Error("expected invalid script to fail")
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			`runPipeline ok sh -c "echo one; echo two" | sh -c "read a; read b; echo pipeline $$b-$$a" | tr a-z A-Z`,
+			`runPipeline stderr sh -c "for i in 1 2 3; do echo left $$i >&2; done; echo data" | sh -c "for i in 1 2 3; do echo middle $$i >&2; done; cat" | sh -c "cat >&2"`,
+			`runPipeline failed sh -c "exit 2" | sh -c "cat; exit 0"`,
+			"setIgnoredExitCodes [2]",
+			`runPipeline ignored sh -c "exit 2" | sh -c "cat; exit 0"`,
+			`runPipeline!ignoreFailures missing autoshell-missing-binary | cat`,
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Fatal("expected workflow to fail")
+	}
+	log := r.logTail.String()
+	for _, expected := range []string{"PIPELINE TWO-ONE\n", "left 3\n", "middle 3\n", "data\n", "runPipeline failed: stage 1 (sh): exit status 2 (exit codes: 2 | 0)\n"} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, log)
+		}
+	}
+	statuses := make([]string, len(r.commandResults))
+	for i, result := range r.commandResults {
+		statuses[i] = result.status
+	}
+	if expected := []string{commandStatusOk, commandStatusOk, commandStatusFailed, commandStatusIgnored, commandStatusIgnored}; !slices.Equal(statuses, expected) {
+		t.Errorf("expected statuses %q, got %q", expected, statuses)
+	}
+	if r.lastFailedExitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", r.lastFailedExitCode)
+	}
+	if _, err := splitPipeline([]string{"a", "|", "|", "b"}); err == nil {
+		t.Error("expected empty stage to be rejected")
+	}
+}
+
+func TestCommandStdin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "input"), []byte("from file\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setWorkDir " + filepath.ToSlash(dir),
+			"setLocalVar passphrase 'from var'",
+			"runShell!stdinFile=input file 'read line; echo got $$line'",
+			"runShell!stdinVar=passphrase,retries=1 var 'read line; echo got $$line; [ -e retried ] || { : > retried; exit 1; }'",
+			"runShell!stdin heredoc 'cat' <<EOF",
+			"from $passphrase",
+			"heredoc",
+			"EOF",
+			"runShell!stdinVar=missing missing 'cat'",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Fatal("expected missing variable to fail")
+	}
+	log := r.logTail.String()
+	for _, expected := range []string{"got from file\n", "got from var\n", "from from var\nheredoc", `variable "missing" not set`} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, log)
+		}
+	}
+	if result := r.commandResults[1]; result.status != commandStatusRetried {
+		t.Errorf("expected stdin to be read again on retry, got %+v", result)
+	}
+	if _, _, err := r.commandOptions(newRootScope(), nil, map[string]string{"stdin": "true", "stdinVar": "a"}); err == nil {
+		t.Error("expected multiple stdin modifiers to be rejected")
+	}
+}
+
+func TestCommandOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setWorkDir " + filepath.ToSlash(dir),
+			"runShell!stdoutFile=out.txt,stderrFile=err.txt plain 'echo plain; echo warning >&2'",
+			"runShell!stdoutFile=out.txt.gz gzip 'echo gzip'",
+			"runShell!stdoutFile=out.txt.zst zstd 'echo zstd'",
+			"runShell!stderrFile=err.txt,append,retries=1 append 'echo failure >&2; exit 1'",
+			"runShell!stdoutFile=both.txt,stderrFile=both.txt both 'echo out; echo err >&2; echo out'",
+			"runShell!stderrFile=err.txt.gz pipeline 'for i in 1 2 3; do echo left >&2; done | for i in 1 2 3; do echo right >&2; done'",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Fatal("expected workflow to fail")
+	}
+	log := r.logTail.String()
+	if strings.Contains(log, "\nplain\n") || !strings.Contains(log, "warning\n") {
+		t.Errorf("expected only stderr to be logged, got %q", log)
+	}
+	readFile := func(name string) string {
+		t.Helper()
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("open file: %v", err)
+		}
+		defer file.Close()
+		var reader io.Reader = file
+		switch filepath.Ext(name) {
+		case ".gz":
+			if reader, err = gzip.NewReader(file); err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+		case ".zst":
+			if reader, err = zstd.NewReader(file); err != nil {
+				t.Fatalf("zstd reader: %v", err)
+			}
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		return string(data)
+	}
+	for name, expected := range map[string]string{
+		"out.txt":     "plain\n",
+		"out.txt.gz":  "gzip\n",
+		"out.txt.zst": "zstd\n",
+		"err.txt":     "warning\nfailure\nfailure\n",
+		"both.txt":    "out\nerr\nout\n",
+	} {
+		if content := readFile(name); content != expected {
+			t.Errorf("expected %s to contain %q, got %q", name, expected, content)
+		}
+	}
+	if content := readFile("err.txt.gz"); strings.Count(content, "left\n") != 3 || strings.Count(content, "right\n") != 3 {
+		t.Errorf("expected stderr of both sides of the pipeline in the compressed file, got %q", content)
+	}
+	if runtime.GOOS != "windows" {
+		if fileInfo, err := os.Stat(filepath.Join(dir, "out.txt")); err != nil || fileInfo.Mode().Perm() != outputFilePerm {
+			t.Errorf("expected output file to be created with mode %o, got %v (%v)", outputFilePerm, fileInfo.Mode(), err)
+		}
+	}
+}
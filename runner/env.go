@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+var cleanEnvAllowlist = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "TZ", "TMPDIR", "TERM",
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA",
+}
+
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+func processEnv() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry[1:], "=")
+		if !found {
+			continue
+		}
+		env[envKey(entry[:1]+name)] = value
+	}
+	return env
+}
+
+func (r *Runner) lookupEnv(name string, localEnv map[string]string) (string, bool) {
+	if value, ok := localEnv[envKey(name)]; ok {
+		return value, true
+	}
+	value, ok := r.env[envKey(name)]
+	return value, ok
+}
+
+func (r *Runner) commandEnv(localEnv map[string]string, modifiers map[string]string) map[string]string {
+	env := maps.Clone(r.env)
+	maps.Copy(env, localEnv)
+	if allowlistStr, ok := modifiers["cleanEnv"]; ok {
+		allowlist := cleanEnvAllowlist
+		if allowlistStr != "true" {
+			allowlist = strings.Split(allowlistStr, "|")
+		}
+		for name := range env {
+			if !slices.ContainsFunc(allowlist, func(allowed string) bool { return envKey(allowed) == name }) {
+				delete(env, name)
+			}
+		}
+	}
+	if envModifier, ok := modifiers["env"]; ok {
+		for entry := range strings.SplitSeq(envModifier, "\n") {
+			name, value, _ := strings.Cut(entry, "=")
+			env[envKey(name)] = value
+		}
+	}
+	return env
+}
+
+func formatEnv(env map[string]string) []string {
+	entries := make([]string, 0, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		entries = append(entries, name+"="+env[name])
+	}
+	return entries
+}
+
+func lookPath(file string, env map[string]string) string {
+	if strings.ContainsAny(file, `/\`) {
+		return file
+	}
+	for _, dir := range filepath.SplitList(env[envKey("PATH")]) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, file)); err == nil {
+			return path
+		}
+	}
+	return file
+}
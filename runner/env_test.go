@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"autoshell/config"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommandEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	t.Setenv("AUTOSHELL_TEST_INHERITED", "inherited")
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setEnvVar AUTOSHELL_TEST_GLOBAL global",
+			"runWorkflow child",
+			`runCommand after sh -c "echo after $$AUTOSHELL_TEST_GLOBAL-$${AUTOSHELL_TEST_LOCAL:-unset}"`,
+			"unsetEnvVar AUTOSHELL_TEST_GLOBAL",
+			`runCommand unset sh -c "echo unset $${AUTOSHELL_TEST_GLOBAL:-unset}"`,
+		}, "\n")},
+		"child": {Instructions: strings.Join([]string{
+			"setLocalEnvVar AUTOSHELL_TEST_LOCAL local",
+			`runCommand!env=AUTOSHELL_TEST_A=a,env=AUTOSHELL_TEST_B=b=c child sh -c "echo child $$AUTOSHELL_TEST_GLOBAL-$$AUTOSHELL_TEST_LOCAL-$$AUTOSHELL_TEST_A-$$AUTOSHELL_TEST_B-$$AUTOSHELL_TEST_INHERITED"`,
+			`runCommand!cleanEnv clean sh -c "echo clean $${AUTOSHELL_TEST_INHERITED:-unset}-$${PATH:+path}"`,
+			`runCommand!cleanEnv=AUTOSHELL_TEST_LOCAL allowlist /bin/sh -c "echo allowlist $$AUTOSHELL_TEST_LOCAL-$${AUTOSHELL_TEST_GLOBAL:-unset}"`,
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	log := r.logTail.String()
+	for _, expected := range []string{
+		"child global-local-a-b=c-inherited\n",
+		"clean unset-path\n",
+		"allowlist local-unset\n",
+		"after global-unset\n",
+		"unset unset\n",
+	} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, log)
+		}
+	}
+	if _, ok := os.LookupEnv("AUTOSHELL_TEST_GLOBAL"); ok {
+		t.Error("expected process environment to be left unchanged")
+	}
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func readEnvFile(filePath string) ([][2]string, error) {
+	file, err := os.Open(filePath) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+	var entries [][2]string
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: invalid entry", lineNum)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = unescapeEnvValue(value[1 : len(value)-1])
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		entries = append(entries, [2]string{name, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return entries, nil
+}
+
+func unescapeEnvValue(value string) string {
+	text := new(strings.Builder)
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			switch value[i+1] {
+			case 'n':
+				text.WriteByte('\n')
+				i++
+				continue
+			case '"', '\\':
+				text.WriteByte(value[i+1])
+				i++
+				continue
+			}
+		}
+		text.WriteByte(value[i])
+	}
+	return text.String()
+}
+
+func readValueFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"autoshell/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "prod.env")
+	data := "# comment\n\nexport RCLONE_BWLIMIT=2M # bandwidth\nGREETING=\"hello\\nworld\"\nRAW='a # b'\nEMPTY=\nWIN_PATH=\"C:\\Users\\backup\"\nESCAPED=\"say \\\"hi\\\" \\\\ \\$HOME\"\n"
+	if err := os.WriteFile(filePath, []byte(data), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	entries, err := readEnvFile(filePath)
+	if err != nil {
+		t.Fatalf("read env file: %v", err)
+	}
+	expected := [][2]string{{"RCLONE_BWLIMIT", "2M"}, {"GREETING", "hello\nworld"}, {"RAW", "a # b"}, {"EMPTY", ""}, {"WIN_PATH", `C:\Users\backup`}, {"ESCAPED", `say "hi" \ \$HOME`}}
+	if !slices.Equal(entries, expected) {
+		t.Errorf("expected entries %q, got %q", expected, entries)
+	}
+	if err := os.WriteFile(filePath, []byte("NOT AN ENTRY\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := readEnvFile(filePath); err == nil {
+		t.Error("expected invalid entry to be rejected")
+	}
+}
+
+func TestOverrideVar(t *testing.T) {
+	r := New(config.Config{LockedVars: []string{"resticPassword"}, Workflows: map[string]config.Workflow{
+		"main": {Instructions: "setGlobalVar resticDestination b2"},
+	}})
+	if err := r.OverrideVar("resticDestination", "ext-hdd"); err != nil {
+		t.Fatalf("override var: %v", err)
+	}
+	if err := r.OverrideVar("resticPassword", "hunter2"); err == nil {
+		t.Error("expected locked var to be rejected")
+	}
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	if r.vars["resticDestination"] != "ext-hdd" {
+		t.Errorf("expected override to take precedence over setGlobalVar, got %q", r.vars["resticDestination"])
+	}
+}
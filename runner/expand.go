@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const specialParams = "?#!*-"
+
+type expander struct {
+	lookup func(name string) (string, bool)
+	funcs  map[string]func(arg string) (string, error)
+}
+
+func (e expander) expand(s string) (string, error) {
+	text := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			text.WriteByte(s[i])
+			continue
+		}
+		var expr string
+		switch next := s[i+1]; {
+		case next == '{':
+			end := closingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("bad substitution: %s", s[i:])
+			}
+			expr = s[i+2 : end]
+			if expr == "" {
+				return "", errors.New("bad substitution: ${}")
+			}
+			i = end
+		case next == '$' || next == '@' || strings.IndexByte(specialParams, next) >= 0 || isDigit(next):
+			expr = s[i+1 : i+2]
+			i++
+		default:
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || isDigit(s[end]) || isLetter(s[end])) {
+				end++
+			}
+			if end == i+1 {
+				text.WriteByte(s[i])
+				continue
+			}
+			expr = s[i+1 : end]
+			i = end - 1
+		}
+		value, err := e.expandParam(expr)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(value)
+	}
+	return text.String(), nil
+}
+
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (e expander) expandParam(expr string) (string, error) {
+	if expr == varPrefix {
+		return varPrefix, nil
+	}
+	if funcName, arg, found := strings.Cut(expr, ":"); found && e.funcs[funcName] != nil && !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "?") && !strings.HasPrefix(arg, "+") {
+		arg, err := e.expand(arg)
+		if err != nil {
+			return "", err
+		}
+		value, err := e.funcs[funcName](arg)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", funcName, err)
+		}
+		return value, nil
+	}
+	if len(expr) == 1 && strings.Contains(specialParams, expr) {
+		return varPrefix + expr, nil
+	}
+	name := paramName(expr)
+	if name == "" {
+		return "", fmt.Errorf("bad substitution: ${%s}", expr)
+	}
+	op := expr[len(name):]
+	value, set := e.lookup(name)
+	if op == "" {
+		return value, nil
+	}
+	colon := strings.HasPrefix(op, ":")
+	missing := !set || (colon && value == "")
+	switch trimmedOp := strings.TrimPrefix(op, ":"); {
+	case strings.HasPrefix(trimmedOp, "-"):
+		if missing {
+			return e.expand(trimmedOp[1:])
+		}
+		return value, nil
+	case strings.HasPrefix(trimmedOp, "?"):
+		if missing {
+			message, err := e.expand(trimmedOp[1:])
+			if err != nil {
+				return "", err
+			}
+			if message == "" {
+				message = "parameter not set"
+			}
+			return "", errors.New(name + ": " + message)
+		}
+		return value, nil
+	case strings.HasPrefix(trimmedOp, "+"):
+		if missing {
+			return "", nil
+		}
+		return e.expand(trimmedOp[1:])
+	case colon:
+		return substring(value, trimmedOp)
+	}
+	switch op {
+	case "^^":
+		return strings.ToUpper(value), nil
+	case ",,":
+		return strings.ToLower(value), nil
+	case "^", ",":
+		runes := []rune(value)
+		if len(runes) > 0 {
+			if op == "^" {
+				runes[0] = unicode.ToUpper(runes[0])
+			} else {
+				runes[0] = unicode.ToLower(runes[0])
+			}
+		}
+		return string(runes), nil
+	}
+	if pattern, found := strings.CutPrefix(op, "/"); found {
+		replaceAll := strings.HasPrefix(pattern, "/")
+		if replaceAll {
+			pattern = pattern[1:]
+		}
+		old, replacement, _ := strings.Cut(pattern, "/")
+		if old == "" {
+			return value, nil
+		}
+		replacement, err := e.expand(replacement)
+		if err != nil {
+			return "", err
+		}
+		if replaceAll {
+			return strings.ReplaceAll(value, old, replacement), nil
+		}
+		return strings.Replace(value, old, replacement, 1), nil
+	}
+	return "", fmt.Errorf("bad substitution: ${%s}", expr)
+}
+
+func paramName(expr string) string {
+	if strings.HasPrefix(expr, "@") {
+		return "@"
+	}
+	end := strings.IndexFunc(expr, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if end < 0 {
+		end = len(expr)
+	}
+	return expr[:end]
+}
+
+func substring(value string, spec string) (string, error) {
+	runes := []rune(value)
+	offsetStr, lengthStr, hasLength := strings.Cut(spec, ":")
+	offset, err := strconv.Atoi(strings.TrimSpace(offsetStr))
+	if err != nil {
+		return "", fmt.Errorf("invalid substring offset %q", offsetStr)
+	}
+	if offset < 0 {
+		offset += len(runes)
+	}
+	offset = min(max(offset, 0), len(runes))
+	end := len(runes)
+	if hasLength {
+		length, err := strconv.Atoi(strings.TrimSpace(lengthStr))
+		if err != nil {
+			return "", fmt.Errorf("invalid substring length %q", lengthStr)
+		}
+		if length < 0 {
+			end = len(runes) + length
+		} else {
+			end = offset + length
+		}
+		end = min(max(end, offset), len(runes))
+	}
+	return string(runes[offset:end]), nil
+}
@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"autoshell/config"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokeniseExpansion(t *testing.T) {
+	r := New(config.Config{})
+	r.vars["destination"] = "b2:Backups/db"
+	r.vars["empty"] = ""
+	r.vars["host"] = "db1.example.com"
+	args := []string{"prod"}
+	vars := map[string]string{"name": "autoshell"}
+	for _, tc := range []struct {
+		instruction string
+		expected    []string
+	}{
+		{`print $1 ${2:-staging}`, []string{"print", "prod", "staging"}},
+		{`print ${empty:-fallback} ${empty-fallback}`, []string{"print", "fallback"}},
+		{`print ${missing-$name}`, []string{"print", "autoshell"}},
+		{`print ${destination:+--repo=$destination} ${missing:+--repo}`, []string{"print", "--repo=b2:Backups/db"}},
+		{`print ${destination/:/-} ${host//./_}`, []string{"print", "b2-Backups/db", "db1_example_com"}},
+		{`print ${name^^} ${name^} ${host:0:3} ${host: -3}`, []string{"print", "AUTOSHELL", "Autoshell", "db1", "com"}},
+		{`print $$ "${1:?}"`, []string{"print", "$", "prod"}},
+		{`print ${missing:-${name}/x} ${missing:-${empty:-${host}}} ${name:+{${name}}}`, []string{"print", "autoshell/x", "db1.example.com", "{autoshell}"}},
+		{`print "false; echo $?" $# ${!} $* $- $0`, []string{"print", "false; echo $?", "$#", "$!", "$*", "$-"}},
+	} {
+		tokens, err := r.tokenise(instruction{text: tc.instruction}, args, &scope{vars: vars, dirs: []string{""}})
+		if err != nil {
+			t.Errorf("tokenise %q: %v", tc.instruction, err)
+			continue
+		}
+		if !slices.Equal(tokens, tc.expected) {
+			t.Errorf("expected %q to be tokenised as %q, got %q", tc.instruction, tc.expected, tokens)
+		}
+	}
+	for text, expected := range map[string]string{
+		`print ${2:?destination is required}`: "2: destination is required",
+		`print ${empty:?}`:                    "empty: parameter not set",
+		`print ${name%.*}`:                    "bad substitution: ${name%.*}",
+		`print ${?:-0}`:                       "bad substitution: ${?:-0}",
+		`print ${missing:?need ${name}}`:      "missing: need autoshell",
+		`print ${missing:-${name}`:            "bad substitution: ${missing:-${name}",
+	} {
+		if _, err := r.tokenise(instruction{text: text}, args, &scope{vars: vars, dirs: []string{""}}); err == nil || err.Error() != expected {
+			t.Errorf("expected %q to fail with %q, got %v", text, expected, err)
+		}
+	}
+}
+
+func TestTokeniseBuiltins(t *testing.T) {
+	r := New(config.Config{})
+	r.workflow = "main"
+	r.env[envKey("AUTOSHELL_TEST_REPO")] = "b2:restic"
+	filePath := filepath.Join(t.TempDir(), "b2_key")
+	if err := os.WriteFile(filePath, []byte("K005abcdef\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	text := `print ${now:2006} $hostname $workflow $runId ${os}-${arch} ${env:AUTOSHELL_TEST_REPO} ${file:` + filePath + `} ${sha256:abc}`
+	tokens, err := r.tokenise(instruction{text: text}, nil, newRootScope())
+	if err != nil {
+		t.Fatalf("tokenise: %v", err)
+	}
+	expected := []string{
+		"print",
+		strconv.Itoa(time.Now().Year()),
+		hostname,
+		"main",
+		r.runId,
+		runtime.GOOS + "-" + runtime.GOARCH,
+		"b2:restic",
+		"K005abcdef",
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	}
+	if !slices.Equal(tokens, expected) {
+		t.Errorf("expected %q, got %q", expected, tokens)
+	}
+	tokens, err = r.tokenise(instruction{text: "print $uuid $uuid"}, nil, &scope{vars: map[string]string{"os": "custom"}, dirs: []string{""}})
+	if err != nil {
+		t.Fatalf("tokenise: %v", err)
+	}
+	if len(tokens) != 3 || len(tokens[1]) != 36 || tokens[1] == tokens[2] {
+		t.Errorf("expected two different UUIDs, got %q", tokens)
+	}
+	if tokens, _ := r.tokenise(instruction{text: "print $os"}, nil, &scope{vars: map[string]string{"os": "custom"}, dirs: []string{""}}); !slices.Equal(tokens, []string{"print", "custom"}) {
+		t.Errorf("expected vars to take precedence over builtins, got %q", tokens)
+	}
+	if _, err := r.tokenise(instruction{text: "print ${file:" + filepath.Join(t.TempDir(), "missing") + "}"}, nil, newRootScope()); err == nil {
+		t.Error("expected missing file to fail")
+	}
+	tokens, err = r.tokenise(instruction{text: "print ${file:-default} ${file:0:2} ${file} ${env:-x} ${env:+y}"}, nil, &scope{vars: map[string]string{"file": "report.txt"}, dirs: []string{""}})
+	if err != nil {
+		t.Fatalf("tokenise: %v", err)
+	}
+	if expected := []string{"print", "report.txt", "re", "report.txt", "x"}; !slices.Equal(tokens, expected) {
+		t.Errorf("expected vars and operators to take precedence over builtin functions, got %q", tokens)
+	}
+}
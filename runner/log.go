@@ -0,0 +1,418 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	logFormatHuman = "human"
+	logFormatJson  = "json"
+)
+
+const (
+	logTargetConsole = "console"
+	logTargetFile    = "file"
+	logTargetAll     = "all"
+)
+
+const (
+	eventMessage      = "message"
+	eventRunStart     = "runStart"
+	eventRunEnd       = "runEnd"
+	eventCommandStart = "commandStart"
+	eventCommandEnd   = "commandEnd"
+	eventOutput       = "output"
+)
+
+const (
+	levelInfo  = "info"
+	levelError = "error"
+)
+
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+type logOptions struct {
+	timestamps bool
+	streams    bool
+}
+
+const logTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+type logEvent struct {
+	Time       time.Time `json:"time"`
+	Level      string    `json:"level"`
+	Event      string    `json:"event"`
+	Workflow   string    `json:"workflow,omitempty"`
+	CommandId  string    `json:"commandId,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	DurationMs *int64    `json:"durationMs,omitempty"`
+	Stream     string    `json:"stream,omitempty"`
+	Message    string    `json:"message,omitempty"`
+
+	skipConsole bool
+}
+
+func (r *Runner) SetLogFormat(format string) error {
+	return r.setLogFormat(format, logTargetAll)
+}
+
+func (r *Runner) setLogFormat(format string, target string) error {
+	if format != logFormatHuman && format != logFormatJson {
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	switch target {
+	case logTargetConsole:
+		r.consoleLogFormat = format
+	case logTargetFile:
+		r.fileLogFormat = format
+	case logTargetAll:
+		r.consoleLogFormat = format
+		r.fileLogFormat = format
+	default:
+		return fmt.Errorf("invalid log target %q", target)
+	}
+	return nil
+}
+
+func (r *Runner) setLogOptions(options []string) error {
+	for _, optionList := range options {
+		for option := range strings.SplitSeq(optionList, ",") {
+			k, v, found := strings.Cut(option, "=")
+			if !found {
+				v = "true"
+			}
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid value for log option %q: %w", k, err)
+			}
+			switch k {
+			case "timestamps":
+				r.logOptions.timestamps = enabled
+			case "streams":
+				r.logOptions.streams = enabled
+			default:
+				return fmt.Errorf("invalid log option %q", k)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) log(format string, args ...any) {
+	var message string
+	if format != "" {
+		message = fmt.Sprintf(format, args...)
+	}
+	r.logEvent(logEvent{Event: eventMessage, Message: message})
+}
+
+func (r *Runner) logError(format string, args ...any) {
+	r.logEvent(logEvent{Level: levelError, Event: eventMessage, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Runner) logEvent(event logEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Level == "" {
+		event.Level = levelInfo
+	}
+	if event.Workflow == "" {
+		event.Workflow = r.workflow
+	}
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	event.Message = r.maskSecrets(event.Message)
+	if !event.skipConsole {
+		fmt.Print(r.renderLogEvent(event, r.consoleLogFormat))
+	}
+	r.logTail.WriteString(r.renderLogEvent(event, logFormatHuman))
+	if r.logFile != nil {
+		if err := r.appendToLogFile(r.renderLogEvent(event, r.fileLogFormat)); err != nil {
+			fmt.Println("Failed to write to log file: " + err.Error())
+		}
+	} else {
+		r.bufferLogEvent(event)
+	}
+	for _, sink := range r.logSinks {
+		if err := sink.write(event); err != nil {
+			fmt.Printf("Failed to write to %s log sink: %s\n", sink.kind, err)
+		}
+	}
+}
+
+func (r *Runner) bufferLogEvent(event logEvent) {
+	r.logFileBuffer = append(r.logFileBuffer, event)
+	r.logFileBufferBytes += len(event.Message)
+	var dropped int
+	for r.logFileBufferBytes > logFileBufferMaxBytes && dropped < len(r.logFileBuffer)-1 {
+		r.logFileBufferBytes -= len(r.logFileBuffer[dropped].Message)
+		dropped++
+	}
+	if dropped > 0 {
+		r.logFileBuffer = slices.Delete(r.logFileBuffer, 0, dropped)
+		r.logFileBufferDropped += dropped
+	}
+}
+
+func (r *Runner) renderLogEvent(event logEvent, format string) string {
+	if format == logFormatJson {
+		if event.Event == eventMessage && event.Message == "" {
+			return ""
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return ""
+		}
+		return string(data) + "\n"
+	}
+	if event.Event == eventOutput {
+		var prefix string
+		if r.logOptions.timestamps {
+			prefix += event.Time.Format(logTimestampLayout) + " "
+		}
+		if r.logOptions.streams {
+			if event.Stream == streamStderr {
+				prefix += "[err] "
+			} else {
+				prefix += "[out] "
+			}
+		}
+		return prefix + event.Message + "\n"
+	}
+	if event.Event != eventMessage && event.Message == "" {
+		return ""
+	}
+	text := strings.Repeat("-", 80) + "\n"
+	if event.Message != "" {
+		text += event.Message + "\n"
+	}
+	return text
+}
+
+func (r *Runner) capturesOutput() bool {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	return !term.IsTerminal(int(os.Stdout.Fd())) || r.logFile != nil || len(r.logSinks) > 0 || len(r.secrets) > 0 || //nolint:gosec
+		r.consoleLogFormat != logFormatHuman || r.logOptions.timestamps || r.logOptions.streams
+}
+
+type outputWriter struct {
+	mutex           sync.Mutex
+	console         io.Writer
+	consolePartLine bool
+	lines           *lineWriter
+}
+
+func (r *Runner) newOutputWriter(commandId string, attempt int, stream string) *outputWriter {
+	w := &outputWriter{}
+	r.logMutex.Lock()
+	hasSecrets := len(r.secrets) > 0
+	r.logMutex.Unlock()
+	if r.consoleLogFormat == logFormatHuman && !r.logOptions.timestamps && !r.logOptions.streams && !hasSecrets {
+		w.console = os.Stdout
+		if stream == streamStderr {
+			w.console = os.Stderr
+		}
+	}
+	w.lines = &lineWriter{onLine: func(line string) {
+		r.logEvent(logEvent{Event: eventOutput, CommandId: commandId, Attempt: attempt, Stream: stream, Message: line, skipConsole: w.console != nil})
+	}}
+	return w
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.console != nil && len(p) > 0 {
+		_, _ = w.console.Write(p)
+		w.consolePartLine = p[len(p)-1] != '\n'
+	}
+	return w.lines.Write(p)
+}
+
+func (w *outputWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.consolePartLine {
+		_, _ = w.console.Write([]byte("\n"))
+		w.consolePartLine = false
+	}
+	w.lines.Flush()
+}
+
+func (r *Runner) renderLogFileBuffer() string {
+	text := new(strings.Builder)
+	if r.logFileBufferDropped > 0 {
+		text.WriteString(r.renderLogEvent(logEvent{
+			Time:     time.Now(),
+			Level:    levelError,
+			Event:    eventMessage,
+			Workflow: r.workflow,
+			Message:  fmt.Sprintf("%d earlier log events were dropped", r.logFileBufferDropped),
+		}, r.fileLogFormat))
+	}
+	for _, event := range r.logFileBuffer {
+		text.WriteString(r.renderLogEvent(event, r.fileLogFormat))
+	}
+	return text.String()
+}
+
+func (r *Runner) readRunLog(maxBytes int64) ([]byte, error) {
+	if r.logFile == nil {
+		data := []byte(r.renderLogFileBuffer())
+		return data[max(0, int64(len(data))-maxBytes):], nil
+	}
+	file, err := os.Open(r.logFile.path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	offset := min(max(r.logFile.runOffset, fileInfo.Size()-maxBytes), fileInfo.Size())
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, fileInfo.Size()-offset))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return data, nil
+}
+
+func (r *Runner) openLogFile(filePath string, modifiers map[string]string) error {
+	options, err := parseLogFileOptions(filePath, modifiers)
+	if err != nil {
+		return err
+	}
+	filePath, pattern := expandLogFilePath(filePath, r.workflow, time.Now())
+	file, err := openRotatingFile(filePath, options)
+	if err != nil {
+		return err
+	}
+	if pattern != filePath && options.keep > 0 {
+		if err := pruneRunLogs(pattern, filePath, options.keep); err != nil {
+			r.logError("Failed to prune old log files: %s", err)
+		}
+	}
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	if _, err := file.WriteString(r.renderLogFileBuffer()); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("write to file: %w", err)
+	}
+	if r.logFile != nil {
+		_ = r.logFile.Close()
+	}
+	r.logFile = file
+	r.logFileBuffer = nil
+	r.logFileBufferBytes = 0
+	r.logFileBufferDropped = 0
+	return nil
+}
+
+func (r *Runner) closeLogFile() {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	if r.logFile != nil {
+		_ = r.logFile.Close()
+		r.logFile = nil
+	}
+}
+
+func (r *Runner) closeLogSinks() {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	for _, sink := range r.logSinks {
+		_ = sink.close()
+	}
+	r.logSinks = nil
+}
+
+func (r *Runner) appendToLogFile(text string) error {
+	if _, err := r.logFile.WriteString(text); err != nil {
+		return fmt.Errorf("write to file: %w", err)
+	}
+	return nil
+}
+
+type tailBuffer struct {
+	maxLen  int
+	buf     []byte
+	written int
+}
+
+func (b *tailBuffer) WriteString(s string) {
+	b.buf = append(b.buf, s...)
+	b.written += len(s)
+	if excess := len(b.buf) - b.maxLen; excess > 0 {
+		b.buf = append(b.buf[:0], b.buf[excess:]...)
+	}
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+func (b *tailBuffer) Len() int {
+	return b.written
+}
+
+func (b *tailBuffer) Since(offset int) string {
+	start := b.written - len(b.buf)
+	return string(b.buf[max(0, offset-start):])
+}
+
+const (
+	maxLogLineBytes       = 64 * 1024
+	logFileBufferMaxBytes = 16 * 1024 * 1024
+)
+
+type lineWriter struct {
+	mutex  sync.Mutex
+	buf    []byte
+	onLine func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLogLineBytes {
+		w.onLine(string(w.buf))
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.buf) > 0 {
+		w.onLine(string(w.buf))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"autoshell/config"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{onLine: func(line string) { lines = append(lines, line) }}
+	for _, chunk := range []string{"first\nsec", "ond\r\n", "\nthird"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	w.Flush()
+	if expected := []string{"first", "second", "", "third"}; !slices.Equal(lines, expected) {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+	lines = nil
+	if _, err := w.Write([]byte(strings.Repeat("x", maxLogLineBytes+1))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(lines) != 1 || len(lines[0]) != maxLogLineBytes+1 {
+		t.Error("expected overlong line to be flushed without waiting for a newline")
+	}
+}
+
+func TestRenderOutputEvent(t *testing.T) {
+	event := logEvent{
+		Time:    time.Date(2025, 5, 30, 20, 36, 20, 664000000, time.UTC),
+		Event:   eventOutput,
+		Stream:  streamStderr,
+		Message: "repository not found",
+	}
+	r := New(config.Config{})
+	if text := r.renderLogEvent(event, logFormatHuman); text != "repository not found\n" {
+		t.Errorf("unexpected raw output %q", text)
+	}
+	if err := r.setLogOptions([]string{"timestamps=true,streams"}); err != nil {
+		t.Fatalf("set log options: %v", err)
+	}
+	if text := r.renderLogEvent(event, logFormatHuman); text != "2025-05-30T20:36:20.664Z [err] repository not found\n" {
+		t.Errorf("unexpected prefixed output %q", text)
+	}
+	if err := r.setLogOptions([]string{"colours=true"}); err == nil {
+		t.Error("expected unknown log option to be rejected")
+	}
+}
+
+func TestRenderJsonEvent(t *testing.T) {
+	r := New(config.Config{})
+	eventTime := time.Date(2025, 5, 30, 20, 36, 20, 664000000, time.UTC)
+	for _, tc := range []struct {
+		event    logEvent
+		expected string
+	}{
+		{logEvent{Event: eventRunStart, Workflow: "main", Message: "Started"}, `{"time":"2025-05-30T20:36:20.664Z","level":"info","event":"runStart","workflow":"main","message":"Started"}`},
+		{logEvent{Event: eventCommandStart, Workflow: "main", CommandId: "dump", Attempt: 1}, `{"time":"2025-05-30T20:36:20.664Z","level":"info","event":"commandStart","workflow":"main","commandId":"dump","attempt":1}`},
+		{logEvent{Event: eventOutput, Workflow: "main", CommandId: "dump", Attempt: 1, Stream: streamStdout, Message: "done"}, `{"time":"2025-05-30T20:36:20.664Z","level":"info","event":"output","workflow":"main","commandId":"dump","attempt":1,"stream":"stdout","message":"done"}`},
+		{logEvent{Event: eventCommandEnd, Workflow: "main", CommandId: "dump", Attempt: 1, ExitCode: new(0), DurationMs: new(int64(1200))}, `{"time":"2025-05-30T20:36:20.664Z","level":"info","event":"commandEnd","workflow":"main","commandId":"dump","attempt":1,"exitCode":0,"durationMs":1200}`},
+		{logEvent{Level: levelError, Event: eventMessage, Message: "failed"}, `{"time":"2025-05-30T20:36:20.664Z","level":"error","event":"message","message":"failed"}`},
+		{logEvent{Event: eventRunEnd, Workflow: "main", DurationMs: new(int64(3000))}, `{"time":"2025-05-30T20:36:20.664Z","level":"info","event":"runEnd","workflow":"main","durationMs":3000}`},
+	} {
+		tc.event.Time = eventTime
+		if tc.event.Level == "" {
+			tc.event.Level = levelInfo
+		}
+		if text := r.renderLogEvent(tc.event, logFormatJson); text != tc.expected+"\n" {
+			t.Errorf("expected %s, got %s", tc.expected, text)
+		}
+	}
+	if text := r.renderLogEvent(logEvent{Time: eventTime, Level: levelInfo, Event: eventMessage}, logFormatJson); text != "" {
+		t.Errorf("expected empty message to be dropped, got %s", text)
+	}
+}
+
+func TestLogFormatTarget(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "run.log")
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setLogFormat json file",
+			"setLogFile " + filepath.ToSlash(logFilePath),
+			"runShell hello 'echo hello'",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	if r.consoleLogFormat != logFormatHuman || r.fileLogFormat != logFormatJson {
+		t.Errorf("expected only the file log format to change, got console %q and file %q", r.consoleLogFormat, r.fileLogFormat)
+	}
+	data, err := os.ReadFile(logFilePath)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	var events []string
+	for line := range strings.Lines(string(data)) {
+		var event logEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected JSON line, got %q: %v", line, err)
+		}
+		events = append(events, event.Event)
+		if event.Event == eventOutput && (event.Message != "hello" || event.CommandId != "hello" || event.Stream != streamStdout) {
+			t.Errorf("unexpected output event %+v", event)
+		}
+	}
+	if expected := []string{eventRunStart, eventCommandStart, eventOutput, eventCommandEnd, eventRunEnd, eventMessage}; !slices.Equal(events, expected) {
+		t.Errorf("expected events %q, got %q", expected, events)
+	}
+	if err := r.setLogFormat(logFormatJson, "stdout"); err == nil {
+		t.Error("expected invalid target to be rejected")
+	}
+}
@@ -0,0 +1,241 @@
+package runner
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logFilePerm        = 0o600
+	logDirPerm         = 0o700
+	logFileDefaultKeep = 5
+	logFileDayLayout   = "2006-01-02"
+	logFileTimeLayout  = "20060102-150405"
+)
+
+type logFileOptions struct {
+	maxSize  int64
+	daily    bool
+	keep     int
+	compress bool
+}
+
+type rotatingFile struct {
+	path      string
+	options   logFileOptions
+	file      *os.File
+	size      int64
+	day       string
+	runOffset int64
+}
+
+func parseLogFileOptions(filePath string, modifiers map[string]string) (logFileOptions, error) {
+	options := logFileOptions{
+		daily:    modifiers["daily"] == "true",
+		compress: modifiers["compress"] == "true",
+	}
+	var err error
+	if maxSizeStr, ok := modifiers["maxSize"]; ok {
+		if options.maxSize, err = parseByteSize(maxSizeStr); err != nil {
+			return logFileOptions{}, fmt.Errorf("invalid max size: %w", err)
+		}
+	}
+	if keepStr, ok := modifiers["keep"]; ok {
+		if options.keep, err = strconv.Atoi(keepStr); err != nil || options.keep < 0 {
+			return logFileOptions{}, fmt.Errorf("invalid keep %q", keepStr)
+		}
+	} else if options.maxSize > 0 || options.daily || strings.Contains(filePath, "{timestamp}") {
+		options.keep = logFileDefaultKeep
+	}
+	return options, nil
+}
+
+func parseByteSize(s string) (int64, error) {
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if trimmed, found := strings.CutSuffix(strings.ToUpper(s), suffix); found {
+			s = trimmed
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * multiplier, nil
+}
+
+func expandLogFilePath(filePath string, workflow string, now time.Time) (string, string) {
+	replacer := strings.NewReplacer("{workflow}", workflow, "{timestamp}", now.Format(logFileTimeLayout))
+	globReplacer := strings.NewReplacer("{workflow}", workflow, "{timestamp}", "*")
+	return replacer.Replace(filePath), globReplacer.Replace(filePath)
+}
+
+func openRotatingFile(filePath string, options logFileOptions) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), logDirPerm); err != nil {
+		return nil, fmt.Errorf("mkdir: %w", err)
+	}
+	f := &rotatingFile{path: filePath, options: options}
+	if options.daily {
+		if fileInfo, err := os.Stat(filePath); err == nil && fileInfo.ModTime().Format(logFileDayLayout) != time.Now().Format(logFileDayLayout) {
+			if err := f.shift(); err != nil {
+				return nil, fmt.Errorf("rotate: %w", err)
+			}
+		}
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.runOffset = f.size
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFilePerm)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat file: %w", err)
+	}
+	f.file = file
+	f.size = fileInfo.Size()
+	f.day = time.Now().Format(logFileDayLayout)
+	return nil
+}
+
+func (f *rotatingFile) WriteString(s string) (int, error) {
+	if f.needsRotation(int64(len(s))) {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("rotate: %w", err)
+		}
+	}
+	n, err := f.file.WriteString(s)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) needsRotation(writeLen int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.maxSize > 0 && f.size+writeLen > f.options.maxSize {
+		return true
+	}
+	return f.options.daily && time.Now().Format(logFileDayLayout) != f.day
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	if err := f.shift(); err != nil {
+		return err
+	}
+	f.runOffset = 0
+	return f.open()
+}
+
+func (f *rotatingFile) shift() error {
+	if f.options.keep == 0 {
+		return os.Remove(f.path)
+	}
+	for i := f.options.keep; i >= 1; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			src := f.rotatedPath(i) + ext
+			if i == f.options.keep {
+				if err := os.Remove(src); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+				continue
+			}
+			if err := os.Rename(src, f.rotatedPath(i+1)+ext); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(f.path, f.rotatedPath(1)); err != nil {
+		return err
+	}
+	if f.options.compress {
+		return gzipFile(f.rotatedPath(1))
+	}
+	return nil
+}
+
+func (f *rotatingFile) rotatedPath(i int) string {
+	return f.path + "." + strconv.Itoa(i)
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
+
+func gzipFile(filePath string) error {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(filePath+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFilePerm)
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(dst)
+	if _, err := io.Copy(gzipWriter, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+func pruneRunLogs(pattern string, current string, keep int) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	type runLog struct {
+		path    string
+		modTime time.Time
+	}
+	var runLogs []runLog
+	for _, match := range matches {
+		if match == current {
+			continue
+		}
+		fileInfo, err := os.Stat(match)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+		runLogs = append(runLogs, runLog{path: match, modTime: fileInfo.ModTime()})
+	}
+	slices.SortFunc(runLogs, func(a, b runLog) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	var errs []error
+	for _, runLog := range runLogs[min(max(keep-1, 0), len(runLogs)):] {
+		if err := os.Remove(runLog.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"autoshell/config"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("Max Size", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "autoshell.log")
+		f, err := openRotatingFile(filePath, logFileOptions{maxSize: 10, keep: 2, compress: true})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		for _, text := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+			if _, err := f.WriteString(text); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		for path, expected := range map[string]string{filePath: "fourth\n", filePath + ".1.gz": "third\n", filePath + ".2.gz": "second\n"} {
+			if text := readMaybeGzipped(t, path); text != expected {
+				t.Errorf("expected %s to contain %q, got %q", filepath.Base(path), expected, text)
+			}
+		}
+		if _, err := os.Stat(filePath + ".3.gz"); err == nil {
+			t.Error("expected files beyond the keep count to be deleted")
+		}
+	})
+	t.Run("Daily", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "autoshell.log")
+		if err := os.WriteFile(filePath, []byte("yesterday\n"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		yesterday := time.Now().AddDate(0, 0, -1)
+		if err := os.Chtimes(filePath, yesterday, yesterday); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+		f, err := openRotatingFile(filePath, logFileOptions{daily: true, keep: 1})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if _, err := f.WriteString("today\n"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = f.Close()
+		if text := readMaybeGzipped(t, filePath+".1"); text != "yesterday\n" {
+			t.Errorf("expected previous day to be rotated, got %q", text)
+		}
+		if text := readMaybeGzipped(t, filePath); text != "today\n" {
+			t.Errorf("expected new file for today, got %q", text)
+		}
+	})
+}
+
+func TestPruneRunLogs(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var paths []string
+	for i := range 4 {
+		at := now.Add(time.Duration(i-4) * time.Hour)
+		path, pattern := expandLogFilePath(filepath.Join(dir, "{workflow}-{timestamp}.log"), "main", at)
+		if pattern != filepath.Join(dir, "main-*.log") {
+			t.Fatalf("unexpected pattern %q", pattern)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if err := pruneRunLogs(filepath.Join(dir, "main-*.log"), paths[3], 2); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if exists := err == nil; exists != (i >= 2) {
+			t.Errorf("unexpected existence %t of %s", exists, filepath.Base(path))
+		}
+	}
+	for i := range logFileDefaultKeep {
+		at := now.Add(time.Duration(i-24) * time.Hour)
+		path, _ := expandLogFilePath(filepath.Join(dir, "{workflow}-{timestamp}.log"), "main", at)
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: "setLogFile " + filepath.ToSlash(filepath.Join(dir, "{workflow}-{timestamp}.log"))},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "main-*.log"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(matches) != logFileDefaultKeep || !slices.Contains(matches, paths[3]) {
+		t.Errorf("expected %d newest run logs to be kept by default, got %q", logFileDefaultKeep, matches)
+	}
+}
+
+func readMaybeGzipped(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if filepath.Ext(path) == ".gz" {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		reader = gzipReader
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logSinkTimeout          = 5 * time.Second
+	syslogDefaultTag        = "autoshell"
+	syslogStructuredDataId  = "autoshell@32473"
+	journaldDefaultSocket   = "/run/systemd/journal/socket"
+	syslogSeverityError     = 3
+	syslogSeverityInfo      = 6
+	syslogDefaultFacility   = 1
+	syslogMaxMessageBytes   = 8192
+	journaldMaxMessageBytes = 64 * 1024
+)
+
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type logSink interface {
+	write(event logEvent) error
+	close() error
+}
+
+type logSinkEntry struct {
+	kind string
+	logSink
+}
+
+func newLogSink(kind string, args []string, modifiers map[string]string) (logSink, error) {
+	tag := modifiers["tag"]
+	if tag == "" {
+		tag = syslogDefaultTag
+	}
+	switch kind {
+	case "syslog":
+		facility := syslogDefaultFacility
+		if facilityName, ok := modifiers["facility"]; ok {
+			if facility, ok = syslogFacilities[facilityName]; !ok {
+				return nil, fmt.Errorf("invalid facility %q", facilityName)
+			}
+		}
+		s := &syslogSink{facility: facility, tag: tag}
+		if hostname, err := os.Hostname(); err == nil {
+			s.hostname = hostname
+		}
+		if len(args) == 0 {
+			s.network = "unixgram"
+			s.rfc3164 = true
+			for _, address := range syslogLocalSockets {
+				if _, err := os.Stat(address); err == nil {
+					s.address = address
+					break
+				}
+			}
+			if s.address == "" {
+				return nil, errors.New("local syslog socket not found")
+			}
+		} else {
+			address, err := url.Parse(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("parse address: %w", err)
+			}
+			switch address.Scheme {
+			case "udp", "tcp":
+				s.network = address.Scheme
+				s.address = address.Host
+			case "unix", "unixgram":
+				s.network = "unixgram"
+				s.address = address.Path
+				s.rfc3164 = true
+			default:
+				return nil, fmt.Errorf("invalid scheme %q", address.Scheme)
+			}
+		}
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "journald":
+		j := &journaldSink{socketPath: journaldDefaultSocket, tag: tag}
+		if len(args) > 0 {
+			j.socketPath = args[0]
+		}
+		conn, err := net.DialTimeout("unixgram", j.socketPath, logSinkTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("dial: %w", err)
+		}
+		j.conn = conn
+		return j, nil
+	default:
+		return nil, errors.New("invalid kind")
+	}
+}
+
+type syslogSink struct {
+	network  string
+	address  string
+	rfc3164  bool
+	facility int
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func (s *syslogSink) connect() error {
+	conn, err := net.DialTimeout(s.network, s.address, logSinkTimeout)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogSink) write(event logEvent) error {
+	message := logSinkMessage(event)
+	if message == "" {
+		return nil
+	}
+	if len(message) > syslogMaxMessageBytes {
+		message = message[:syslogMaxMessageBytes]
+	}
+	severity := syslogSeverityInfo
+	if event.Level == levelError {
+		severity = syslogSeverityError
+	}
+	priority := s.facility*8 + severity
+	var data string
+	if s.rfc3164 {
+		data = fmt.Sprintf("<%d>%s %s[%d]: %s", priority, event.Time.Format(time.Stamp), s.tag, os.Getpid(), message)
+	} else {
+		data = fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s", priority, event.Time.Format(time.RFC3339Nano), syslogHeaderValue(s.hostname), syslogHeaderValue(s.tag), os.Getpid(), syslogHeaderValue(event.Event), syslogStructuredData(event), message)
+		if s.network == "tcp" {
+			data = strconv.Itoa(len(data)) + " " + data
+		}
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(logSinkTimeout))
+	if _, err := s.conn.Write([]byte(data)); err != nil {
+		_ = s.conn.Close()
+		if err := s.connect(); err != nil {
+			return err
+		}
+		_ = s.conn.SetWriteDeadline(time.Now().Add(logSinkTimeout))
+		_, err = s.conn.Write([]byte(data))
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return s.conn.Close()
+}
+
+func syslogHeaderValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func syslogStructuredData(event logEvent) string {
+	params := logSinkFields(event)
+	if len(params) == 0 {
+		return "-"
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	text := new(strings.Builder)
+	text.WriteString("[" + syslogStructuredDataId)
+	for _, param := range params {
+		fmt.Fprintf(text, ` %s="%s"`, param[0], escaper.Replace(param[1]))
+	}
+	text.WriteString("]")
+	return text.String()
+}
+
+type journaldSink struct {
+	socketPath string
+	tag        string
+	conn       net.Conn
+}
+
+func (j *journaldSink) write(event logEvent) error {
+	message := logSinkMessage(event)
+	if message == "" {
+		return nil
+	}
+	if len(message) > journaldMaxMessageBytes {
+		message = message[:journaldMaxMessageBytes]
+	}
+	priority := syslogSeverityInfo
+	if event.Level == levelError {
+		priority = syslogSeverityError
+	}
+	fields := [][2]string{
+		{"MESSAGE", message},
+		{"PRIORITY", strconv.Itoa(priority)},
+		{"SYSLOG_IDENTIFIER", j.tag},
+		{"EVENT", event.Event},
+	}
+	for _, field := range logSinkFields(event) {
+		fields = append(fields, [2]string{journaldFieldName(field[0]), field[1]})
+	}
+	buf := new(bytes.Buffer)
+	for _, field := range fields {
+		if !strings.Contains(field[1], "\n") {
+			fmt.Fprintf(buf, "%s=%s\n", field[0], field[1])
+			continue
+		}
+		buf.WriteString(field[0] + "\n")
+		_ = binary.Write(buf, binary.LittleEndian, uint64(len(field[1])))
+		buf.WriteString(field[1] + "\n")
+	}
+	_ = j.conn.SetWriteDeadline(time.Now().Add(logSinkTimeout))
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+func (j *journaldSink) close() error {
+	return j.conn.Close()
+}
+
+func journaldFieldName(name string) string {
+	var text strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			text.WriteRune('_')
+		}
+		text.WriteRune(r)
+	}
+	return strings.ToUpper(text.String())
+}
+
+func logSinkMessage(event logEvent) string {
+	if event.Event == eventOutput {
+		return event.Message
+	}
+	if event.Event == eventCommandEnd && event.Message == "" && event.ExitCode != nil && event.DurationMs != nil {
+		return fmt.Sprintf("%s exited %d after %dms", event.CommandId, *event.ExitCode, *event.DurationMs)
+	}
+	return strings.TrimSpace(event.Message)
+}
+
+func logSinkFields(event logEvent) [][2]string {
+	var fields [][2]string
+	if event.Workflow != "" {
+		fields = append(fields, [2]string{"workflow", event.Workflow})
+	}
+	if event.CommandId != "" {
+		fields = append(fields, [2]string{"commandId", event.CommandId})
+	}
+	if event.Attempt != 0 {
+		fields = append(fields, [2]string{"attempt", strconv.Itoa(event.Attempt)})
+	}
+	if event.ExitCode != nil {
+		fields = append(fields, [2]string{"exitCode", strconv.Itoa(*event.ExitCode)})
+	}
+	if event.DurationMs != nil {
+		fields = append(fields, [2]string{"durationMs", strconv.FormatInt(*event.DurationMs, 10)})
+	}
+	if event.Stream != "" {
+		fields = append(fields, [2]string{"stream", event.Stream})
+	}
+	return fields
+}
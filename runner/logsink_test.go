@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSink(t *testing.T) {
+	exitCode := 3
+	event := logEvent{Time: time.Now(), Level: levelError, Event: eventCommandEnd, Workflow: "main", CommandId: "backup", ExitCode: &exitCode, Message: "backup failed: exit status 3"}
+	t.Run("Syslog UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer conn.Close()
+		sink, err := newLogSink("syslog", []string{"udp://" + conn.LocalAddr().String()}, map[string]string{"facility": "local0"})
+		if err != nil {
+			t.Fatalf("new log sink: %v", err)
+		}
+		defer sink.close()
+		if err := sink.write(event); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		message := string(buf[:n])
+		if !strings.HasPrefix(message, "<131>1 ") {
+			t.Errorf("expected local0.err RFC5424 header, got %q", message)
+		}
+		for _, expected := range []string{" autoshell ", " commandEnd ", `workflow="main"`, `commandId="backup"`, `exitCode="3"`, "backup failed: exit status 3"} {
+			if !strings.Contains(message, expected) {
+				t.Errorf("expected message to contain %q, got %q", expected, message)
+			}
+		}
+	})
+	t.Run("Syslog TCP", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer listener.Close()
+		sink, err := newLogSink("syslog", []string{"tcp://" + listener.Addr().String()}, map[string]string{})
+		if err != nil {
+			t.Fatalf("new log sink: %v", err)
+		}
+		defer sink.close()
+		if err := sink.write(event); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		reader := bufio.NewReader(conn)
+		lenStr, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		msgLen, err := strconv.Atoi(strings.TrimSpace(lenStr))
+		if err != nil {
+			t.Fatalf("parse frame length: %v", err)
+		}
+		buf := make([]byte, msgLen)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !strings.HasPrefix(string(buf), "<11>1 ") {
+			t.Errorf("expected octet-counted user.err RFC5424 message, got %q", buf)
+		}
+	})
+	t.Run("Journald", func(t *testing.T) {
+		socketPath := filepath.Join(t.TempDir(), "journal.socket")
+		conn, err := net.ListenPacket("unixgram", socketPath)
+		if err != nil {
+			t.Skipf("unix datagram sockets not supported: %v", err)
+		}
+		defer conn.Close()
+		sink, err := newLogSink("journald", []string{socketPath}, map[string]string{})
+		if err != nil {
+			t.Fatalf("new log sink: %v", err)
+		}
+		defer sink.close()
+		multiLineEvent := event
+		multiLineEvent.Message = "line 1\nline 2"
+		successEvent := logEvent{Time: time.Now(), Level: levelInfo, Event: eventCommandEnd, Workflow: "main", CommandId: "backup", ExitCode: new(0), DurationMs: new(int64(1200))}
+		for _, e := range []logEvent{event, multiLineEvent, successEvent} {
+			if err := sink.write(e); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		for _, expected := range []string{"MESSAGE=backup failed: exit status 3\n", "PRIORITY=3\n", "SYSLOG_IDENTIFIER=autoshell\n", "WORKFLOW=main\n", "COMMAND_ID=backup\n", "EXIT_CODE=3\n"} {
+			if !strings.Contains(string(buf[:n]), expected) {
+				t.Errorf("expected datagram to contain %q, got %q", expected, buf[:n])
+			}
+		}
+		n, _, err = conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if expected := "MESSAGE\n\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n"; !strings.HasPrefix(string(buf[:n]), expected) {
+			t.Errorf("expected binary-safe message field, got %q", buf[:n])
+		}
+		n, _, err = conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		for _, expected := range []string{"MESSAGE=backup exited 0 after 1200ms\n", "PRIORITY=6\n", "EXIT_CODE=0\n", "DURATION_MS=1200\n"} {
+			if !strings.Contains(string(buf[:n]), expected) {
+				t.Errorf("expected successful command datagram to contain %q, got %q", expected, buf[:n])
+			}
+		}
+	})
+	t.Run("Invalid Options", func(t *testing.T) {
+		for _, tc := range []struct {
+			kind      string
+			args      []string
+			modifiers map[string]string
+		}{
+			{"graylog", nil, map[string]string{}},
+			{"syslog", []string{"http://localhost:514"}, map[string]string{}},
+			{"syslog", []string{"udp://localhost:514"}, map[string]string{"facility": "local9"}},
+			{"journald", []string{filepath.Join(t.TempDir(), "missing.socket")}, map[string]string{}},
+		} {
+			if _, err := newLogSink(tc.kind, tc.args, tc.modifiers); err == nil {
+				t.Errorf("expected %s %v %v to be rejected", tc.kind, tc.args, tc.modifiers)
+			}
+		}
+	})
+}
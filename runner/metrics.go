@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"autoshell/fileutil"
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	metricLastRunTimestamp     = "autoshell_last_run_timestamp_seconds"
+	metricLastSuccessTimestamp = "autoshell_last_success_timestamp_seconds"
+	metricRunDuration          = "autoshell_run_duration_seconds"
+	metricCommandDuration      = "autoshell_command_duration_seconds"
+	metricCommandExitCode      = "autoshell_command_exit_code"
+)
+
+var metricHelp = map[string]string{
+	metricLastRunTimestamp:     "Time the last run ended.",
+	metricLastSuccessTimestamp: "Time the last successful run ended.",
+	metricRunDuration:          "Duration of the last run.",
+	metricCommandDuration:      "Duration of the command in the last run.",
+	metricCommandExitCode:      "Exit code of the command in the last run.",
+}
+
+const (
+	textfilePerm          = 0o644
+	pushgatewayDefaultJob = "autoshell"
+)
+
+type metric struct {
+	name   string
+	labels [][2]string
+	value  float64
+}
+
+type prometheusTextfileReporter struct {
+	filePath string
+}
+
+func (p *prometheusTextfileReporter) start() error {
+	return nil
+}
+
+func (p *prometheusTextfileReporter) end(result runResult) error {
+	prevMetrics, err := readMetrics(p.filePath)
+	if err != nil {
+		return fmt.Errorf("read previous metrics: %w", err)
+	}
+	var metrics []metric
+	var lastSuccess float64
+	for _, m := range prevMetrics {
+		switch {
+		case labelValue(m.labels, "workflow") != result.workflow:
+			metrics = append(metrics, m)
+		case result.command != "":
+			if labelValue(m.labels, "command") != result.command {
+				metrics = append(metrics, m)
+			}
+		case m.name == metricLastSuccessTimestamp:
+			lastSuccess = m.value
+		}
+	}
+	for _, m := range buildMetrics(result, true, lastSuccess) {
+		if result.command == "" || labelValue(m.labels, "command") == result.command {
+			metrics = append(metrics, m)
+		}
+	}
+	slices.SortStableFunc(metrics, func(a, b metric) int {
+		return strings.Compare(labelValue(a.labels, "workflow"), labelValue(b.labels, "workflow"))
+	})
+	return fileutil.AtomicWrite(p.filePath, textfilePerm, func(file *os.File) error {
+		_, err := file.WriteString(formatMetrics(metrics))
+		return err
+	})
+}
+
+func readMetrics(filePath string) ([]metric, error) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var metrics []metric
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if m, ok := parseMetric(scanner.Text()); ok && metricHelp[m.name] != "" {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, scanner.Err()
+}
+
+func parseMetric(line string) (metric, bool) {
+	end := strings.LastIndexByte(line, ' ')
+	if end < 0 || strings.HasPrefix(line, "#") {
+		return metric{}, false
+	}
+	value, err := strconv.ParseFloat(line[end+1:], 64)
+	if err != nil {
+		return metric{}, false
+	}
+	name, labelsStr, hasLabels := strings.Cut(line[:end], "{")
+	m := metric{name: name, value: value}
+	if !hasLabels {
+		return m, true
+	}
+	labelsStr, found := strings.CutSuffix(labelsStr, "}")
+	for found && labelsStr != "" {
+		var key, rest string
+		if key, rest, found = strings.Cut(labelsStr, `="`); !found {
+			break
+		}
+		labelText := new(strings.Builder)
+		i := 0
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				if rest[i] == 'n' {
+					labelText.WriteByte('\n')
+					continue
+				}
+			}
+			labelText.WriteByte(rest[i])
+		}
+		if found = i < len(rest); found {
+			m.labels = append(m.labels, [2]string{key, labelText.String()})
+			labelsStr = strings.TrimPrefix(rest[i+1:], ",")
+		}
+	}
+	return m, found
+}
+
+func labelValue(labels [][2]string, name string) string {
+	for _, label := range labels {
+		if label[0] == name {
+			return label[1]
+		}
+	}
+	return ""
+}
+
+type pushgatewayReporter struct {
+	endpoint  string
+	transport *reporterTransport
+}
+
+func newPushgatewayReporter(endpoint string, modifiers map[string]string, transport *reporterTransport) (reporter, error) {
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	job := modifiers["job"]
+	if job == "" {
+		job = pushgatewayDefaultJob
+	}
+	return &pushgatewayReporter{
+		endpoint:  strings.TrimSuffix(endpoint, "/") + "/metrics/job/" + pushgatewayLabelValue(job),
+		transport: transport,
+	}, nil
+}
+
+func (p *pushgatewayReporter) start() error {
+	return nil
+}
+
+func (p *pushgatewayReporter) end(result runResult) error {
+	endpoint := p.endpoint + "/workflow/" + pushgatewayLabelValue(result.workflow)
+	if result.command != "" {
+		endpoint += "/command/" + pushgatewayLabelValue(result.command)
+	}
+	req, err := newRequest(http.MethodPost, endpoint, "text/plain; version=0.0.4", formatMetrics(buildMetrics(result, false, 0)))
+	if err != nil {
+		return err
+	}
+	return p.transport.send(req)
+}
+
+func pushgatewayLabelValue(value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return url.PathEscape(value)
+}
+
+func buildMetrics(result runResult, withWorkflowLabel bool, lastSuccess float64) []metric {
+	var workflowLabels [][2]string
+	if withWorkflowLabel {
+		workflowLabels = [][2]string{{"workflow", result.workflow}}
+	}
+	end := float64(result.end.UnixMilli()) / 1000
+	if len(result.errMsgs) == 0 {
+		lastSuccess = end
+	}
+	metrics := []metric{
+		{name: metricLastRunTimestamp, labels: workflowLabels, value: end},
+	}
+	if lastSuccess != 0 {
+		metrics = append(metrics, metric{name: metricLastSuccessTimestamp, labels: workflowLabels, value: lastSuccess})
+	}
+	metrics = append(metrics, metric{name: metricRunDuration, labels: workflowLabels, value: result.elapsed.Seconds()})
+	commandIndexes := make(map[string]int)
+	for _, command := range result.commands {
+		if command.status == commandStatusSkipped {
+			continue
+		}
+		labels := append(slices.Clone(workflowLabels), [2]string{"command", command.id})
+		commandMetrics := []metric{
+			{name: metricCommandDuration, labels: labels, value: command.duration.Seconds()},
+			{name: metricCommandExitCode, labels: labels, value: float64(command.exitCode)},
+		}
+		if i, ok := commandIndexes[command.id]; ok {
+			copy(metrics[i:], commandMetrics)
+			continue
+		}
+		commandIndexes[command.id] = len(metrics)
+		metrics = append(metrics, commandMetrics...)
+	}
+	return metrics
+}
+
+func formatMetrics(metrics []metric) string {
+	text := new(strings.Builder)
+	written := make(map[string]bool)
+	for _, name := range []string{metricLastRunTimestamp, metricLastSuccessTimestamp, metricRunDuration, metricCommandDuration, metricCommandExitCode} {
+		for _, m := range metrics {
+			if m.name != name {
+				continue
+			}
+			if !written[name] {
+				fmt.Fprintf(text, "# HELP %s %s\n# TYPE %s gauge\n", name, metricHelp[name], name)
+				written[name] = true
+			}
+			fmt.Fprintf(text, "%s%s %s\n", name, formatLabels(m.labels), strconv.FormatFloat(m.value, 'f', -1, 64))
+		}
+	}
+	return text.String()
+}
+
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(label[1])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label[0], value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	success := runResult{
+		workflow: "backup",
+		end:      time.Date(2025, 5, 30, 20, 36, 20, 0, time.UTC),
+		elapsed:  2500 * time.Millisecond,
+		commands: []commandResult{
+			{id: "create-sql-dump", status: commandStatusRetried, attempts: 2, duration: 1500 * time.Millisecond},
+			{id: "b2-backup-db", status: commandStatusIgnored, attempts: 1, exitCode: 3, duration: time.Second},
+			{id: "cleanup", status: commandStatusSkipped},
+		},
+	}
+	failure := runResult{
+		workflow: "backup",
+		end:      time.Date(2025, 5, 31, 20, 36, 20, 0, time.UTC),
+		elapsed:  time.Second,
+		errMsgs:  []string{"Failed commands: create-sql-dump"},
+		commands: []commandResult{{id: "create-sql-dump", status: commandStatusFailed, attempts: 1, exitCode: 2, duration: time.Second}},
+	}
+	t.Run("Format", func(t *testing.T) {
+		expected := strings.Join([]string{
+			"# HELP autoshell_last_run_timestamp_seconds Time the last run ended.",
+			"# TYPE autoshell_last_run_timestamp_seconds gauge",
+			`autoshell_last_run_timestamp_seconds{workflow="backup"} 1748637380`,
+			"# HELP autoshell_last_success_timestamp_seconds Time the last successful run ended.",
+			"# TYPE autoshell_last_success_timestamp_seconds gauge",
+			`autoshell_last_success_timestamp_seconds{workflow="backup"} 1748637380`,
+			"# HELP autoshell_run_duration_seconds Duration of the last run.",
+			"# TYPE autoshell_run_duration_seconds gauge",
+			`autoshell_run_duration_seconds{workflow="backup"} 2.5`,
+			"# HELP autoshell_command_duration_seconds Duration of the command in the last run.",
+			"# TYPE autoshell_command_duration_seconds gauge",
+			`autoshell_command_duration_seconds{workflow="backup",command="create-sql-dump"} 1.5`,
+			`autoshell_command_duration_seconds{workflow="backup",command="b2-backup-db"} 1`,
+			"# HELP autoshell_command_exit_code Exit code of the command in the last run.",
+			"# TYPE autoshell_command_exit_code gauge",
+			`autoshell_command_exit_code{workflow="backup",command="create-sql-dump"} 0`,
+			`autoshell_command_exit_code{workflow="backup",command="b2-backup-db"} 3`,
+			"",
+		}, "\n")
+		if text := formatMetrics(buildMetrics(success, true, 0)); text != expected {
+			t.Errorf("unexpected metrics:\n%s", text)
+		}
+		if text := formatMetrics(buildMetrics(failure, false, 0)); strings.Contains(text, metricLastSuccessTimestamp) || strings.Contains(text, "workflow=") {
+			t.Errorf("expected failed run without a previous success to have no last success and no workflow label:\n%s", text)
+		}
+		labels := [][2]string{{"workflow", `a "b"` + "\n" + `c\d`}, {"command", "x}"}}
+		if m, ok := parseMetric(metricCommandExitCode + formatLabels(labels) + " 3"); !ok || len(m.labels) != 2 || m.labels[0] != labels[0] || m.labels[1] != labels[1] || m.value != 3 {
+			t.Errorf("expected labels to round trip, got %+v", m)
+		}
+	})
+	t.Run("Textfile", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "autoshell.prom")
+		entry, err := newReporterEntry("prometheusTextfile", filePath, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		prune := runResult{workflow: "prune", end: success.end, elapsed: time.Second}
+		for _, result := range []runResult{success, prune, failure} {
+			if err := entry.end(result); err != nil {
+				t.Fatalf("end: %v", err)
+			}
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		text := string(data)
+		for _, expected := range []string{
+			`autoshell_last_run_timestamp_seconds{workflow="backup"} 1748723780` + "\n",
+			`autoshell_last_success_timestamp_seconds{workflow="backup"} 1748637380` + "\n",
+			`autoshell_last_success_timestamp_seconds{workflow="prune"} 1748637380` + "\n",
+			`autoshell_command_exit_code{workflow="backup",command="create-sql-dump"} 2` + "\n",
+		} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("expected metrics to contain %q, got:\n%s", expected, text)
+			}
+		}
+		if strings.Contains(text, "b2-backup-db") || strings.Count(text, "# TYPE "+metricRunDuration) != 1 {
+			t.Errorf("expected series of the previous run to be replaced, got:\n%s", text)
+		}
+	})
+	t.Run("Textfile Command Scope", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "autoshell.prom")
+		entry, err := newReporterEntry("prometheusTextfile", filePath, map[string]string{"scope": "command"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(success); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		result := failure
+		result.command = "create-sql-dump"
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		text := string(data)
+		for _, expected := range []string{
+			`autoshell_last_run_timestamp_seconds{workflow="backup"} 1748637380` + "\n",
+			`autoshell_run_duration_seconds{workflow="backup"} 2.5` + "\n",
+			`autoshell_command_exit_code{workflow="backup",command="create-sql-dump"} 2` + "\n",
+			`autoshell_command_exit_code{workflow="backup",command="b2-backup-db"} 3` + "\n",
+		} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("expected metrics to contain %q, got:\n%s", expected, text)
+			}
+		}
+		if strings.Count(text, "create-sql-dump") != 2 {
+			t.Errorf("expected command series to be replaced, got:\n%s", text)
+		}
+	})
+	t.Run("Pushgateway", func(t *testing.T) {
+		var path, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			data, _ := io.ReadAll(req.Body)
+			path, body = req.URL.EscapedPath(), string(data)
+		}))
+		defer server.Close()
+		entry, err := newReporterEntry("pushgateway", server.URL+"/", map[string]string{"job": "nightly jobs", "scope": "command"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		result := failure
+		result.workflow = "db/backup"
+		result.command = "create-sql-dump"
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if expected := "/metrics/job/nightly%20jobs/workflow/@base64/ZGIvYmFja3Vw/command/create-sql-dump"; path != expected {
+			t.Errorf("expected path %q, got %q", expected, path)
+		}
+		if !strings.Contains(body, `autoshell_command_exit_code{command="create-sql-dump"} 2`+"\n") {
+			t.Errorf("unexpected body:\n%s", body)
+		}
+	})
+}
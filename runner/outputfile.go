@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const outputFilePerm = 0o600
+
+type outputFile struct {
+	mutex      sync.Mutex
+	file       *os.File
+	compressor io.WriteCloser
+}
+
+func openOutputFile(path string, appendMode bool) (*outputFile, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flag, outputFilePerm) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	f := &outputFile{file: file}
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		f.compressor = gzip.NewWriter(file)
+	case strings.HasSuffix(path, ".zst"):
+		if f.compressor, err = zstd.NewWriter(file); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *outputFile) writer() io.Writer {
+	if f.compressor == nil {
+		return f.file
+	}
+	return f
+}
+
+func (f *outputFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.compressor.Write(p)
+}
+
+func (f *outputFile) Close() error {
+	var err error
+	if f.compressor != nil {
+		err = f.compressor.Close()
+	}
+	return errors.Join(err, f.file.Close())
+}
@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+)
+
+func (r *Runner) OverrideVar(name string, value string) error {
+	if slices.Contains(r.config.LockedVars, name) {
+		return fmt.Errorf("var %q is locked", name)
+	}
+	r.vars[name] = value
+	r.overriddenVars[name] = true
+	return nil
+}
+
+func (r *Runner) OverrideEnvVar(name string, value string) error {
+	if slices.Contains(r.config.LockedVars, name) {
+		return fmt.Errorf("env var %q is locked", name)
+	}
+	r.env[envKey(name)] = value
+	r.overriddenEnvVars[envKey(name)] = true
+	return nil
+}
+
+func (r *Runner) OverrideEnvFile(filePath string) error {
+	entries, err := readEnvFile(filePath)
+	if err != nil {
+		return fmt.Errorf("read env file %q: %w", filePath, err)
+	}
+	for _, entry := range entries {
+		if err := r.OverrideEnvVar(entry[0], entry[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package runner
+
+import (
+	"autoshell/config"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func bindParams(params []config.Param, args []string, vars map[string]string) error {
+	for i, param := range params {
+		value := param.Default
+		if i < len(args) {
+			value = args[i]
+		} else if param.Required {
+			return fmt.Errorf("missing required param %q", param.Name)
+		}
+		if i < len(args) || value != "" {
+			if len(param.Allowed) > 0 && !slices.Contains(param.Allowed, value) {
+				return fmt.Errorf("invalid value %q for param %q, allowed values: %s", value, param.Name, strings.Join(param.Allowed, ", "))
+			}
+			matches, err := param.Matches(value)
+			if err != nil {
+				return fmt.Errorf("param %q: %w", param.Name, err)
+			}
+			if !matches {
+				return fmt.Errorf("invalid value %q for param %q, expected to match %q", value, param.Name, param.Regex)
+			}
+		}
+		vars[param.Name] = value
+	}
+	return nil
+}
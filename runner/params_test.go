@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"autoshell/config"
+	"maps"
+	"testing"
+)
+
+func TestBindParams(t *testing.T) {
+	params := []config.Param{
+		{Name: "destination", Required: true, Allowed: []string{"b2", "ext-hdd"}},
+		{Name: "tag", Default: "daily", Regex: "[a-z]+"},
+		{Name: "host"},
+	}
+	vars := make(map[string]string)
+	if err := bindParams(params, []string{"b2"}, vars); err != nil {
+		t.Fatalf("bind params: %v", err)
+	}
+	if expected := map[string]string{"destination": "b2", "tag": "daily", "host": ""}; !maps.Equal(vars, expected) {
+		t.Errorf("expected vars %v, got %v", expected, vars)
+	}
+	for _, args := range [][]string{
+		{},
+		{"s3"},
+		{"b2", "Daily"},
+		{"b2", "daily-1"},
+	} {
+		if err := bindParams(params, args, make(map[string]string)); err == nil {
+			t.Errorf("expected args %q to be rejected", args)
+		}
+	}
+}
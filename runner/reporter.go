@@ -0,0 +1,373 @@
+package runner
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type reporter interface {
+	start() error
+	end(result runResult) error
+}
+
+const (
+	reporterScopeRun     = "run"
+	reporterScopeCommand = "command"
+)
+
+type reporterEntry struct {
+	kind        string
+	scope       string
+	commandGlob string
+	reporter
+}
+
+type runResult struct {
+	workflow string
+	command  string
+	end      time.Time
+	elapsed  time.Duration
+	err      error
+	errMsgs  []string
+	exitCode int
+	commands []commandResult
+	logTail  string
+	readLog  func(maxBytes int64) ([]byte, error)
+}
+
+func newReporterEntry(kind string, endpoint string, modifiers map[string]string) (reporterEntry, error) {
+	entry := reporterEntry{kind: kind, scope: reporterScopeRun}
+	if scope, ok := modifiers["scope"]; ok {
+		scope, glob, found := strings.Cut(scope, ":")
+		switch {
+		case scope == reporterScopeRun && !found:
+		case scope == reporterScopeCommand:
+			if !found {
+				glob = "*"
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return reporterEntry{}, fmt.Errorf("invalid command ID glob %q: %w", glob, err)
+			}
+			entry.commandGlob = glob
+		default:
+			return reporterEntry{}, fmt.Errorf("invalid scope %q", modifiers["scope"])
+		}
+		entry.scope = scope
+	}
+	transport, err := newReporterTransport(modifiers)
+	if err != nil {
+		return reporterEntry{}, err
+	}
+	if entry.reporter, err = newReporter(kind, endpoint, modifiers, transport); err != nil {
+		return reporterEntry{}, err
+	}
+	return entry, nil
+}
+
+func resolveReporterPaths(kind string, endpoint string, modifiers map[string]string, s *scope) (string, map[string]string) {
+	switch kind {
+	case "prometheusTextfile", "junit", "json":
+		endpoint = s.resolvePath(endpoint)
+	}
+	modifiers = maps.Clone(modifiers)
+	for _, name := range []string{"caFile", "stateFile"} {
+		if path, ok := modifiers[name]; ok {
+			modifiers[name] = s.resolvePath(path)
+		}
+	}
+	return endpoint, modifiers
+}
+
+func (e *reporterEntry) matchesCommand(commandId string) bool {
+	if e.scope != reporterScopeCommand {
+		return false
+	}
+	matched, _ := path.Match(e.commandGlob, commandId)
+	return matched
+}
+
+func newReporter(kind string, endpoint string, modifiers map[string]string, transport *reporterTransport) (reporter, error) {
+	switch kind {
+	case "uptimeKuma":
+		return &uptimeKumaReporter{endpoint: endpoint, transport: transport}, nil
+	case "healthchecks":
+		return &healthchecksReporter{
+			endpoint:     strings.TrimSuffix(endpoint, "/"),
+			exitCodePing: modifiers["exitCode"] == "true",
+			transport:    transport,
+		}, nil
+	case "slack", "discord", "ntfy", "gotify":
+		return newChatReporter(kind, endpoint, modifiers, transport)
+	case "prometheusTextfile":
+		return &prometheusTextfileReporter{filePath: endpoint}, nil
+	case "junit":
+		return &junitReporter{filePath: endpoint}, nil
+	case "json":
+		return &jsonReporter{filePath: endpoint}, nil
+	case "pushgateway":
+		return newPushgatewayReporter(endpoint, modifiers, transport)
+	case "smtp":
+		return newSmtpReporter(endpoint, modifiers, transport)
+	default:
+		return nil, errors.New("invalid kind")
+	}
+}
+
+func (r *Runner) AddReporter(kind string, endpoint string) error {
+	entry, err := newReporterEntry(kind, endpoint, map[string]string{})
+	if err != nil {
+		return fmt.Errorf("add reporter %q: %w", kind, err)
+	}
+	r.reporters = append(r.reporters, entry)
+	return nil
+}
+
+func (r *Runner) report(result runResult) {
+	for _, reporter := range r.reporters {
+		if reporter.scope != reporterScopeRun {
+			continue
+		}
+		if err := reporter.end(result); err != nil {
+			r.logError("Reporter %q failed: %s", reporter.kind, err)
+		}
+	}
+}
+
+func (r *Runner) startCommandReporters(commandId string) {
+	for _, reporter := range r.reporters {
+		if !reporter.matchesCommand(commandId) {
+			continue
+		}
+		if err := reporter.start(); err != nil {
+			r.logError("Reporter %q failed: %s", reporter.kind, err)
+		}
+	}
+}
+
+func (r *Runner) reportCommand(command commandResult, cmdErr error, logTail string) {
+	result := runResult{
+		workflow: r.workflow,
+		command:  command.id,
+		end:      time.Now(),
+		elapsed:  command.duration,
+		commands: []commandResult{command},
+		logTail:  logTail,
+		readLog: func(maxBytes int64) ([]byte, error) {
+			data := []byte(logTail)
+			return data[max(0, int64(len(data))-maxBytes):], nil
+		},
+	}
+	if command.failed() {
+		result.exitCode = command.exitCode
+		result.errMsgs = []string{fmt.Sprintf("Command %s failed: %s", command.id, cmdErr)}
+	}
+	for _, reporter := range r.reporters {
+		if !reporter.matchesCommand(command.id) {
+			continue
+		}
+		if err := reporter.end(result); err != nil {
+			r.logError("Reporter %q failed: %s", reporter.kind, err)
+		}
+	}
+}
+
+const (
+	reporterDefaultTimeout    = 10 * time.Second
+	reporterDefaultRetryDelay = time.Second
+	maxRespBodyBytes          = 8 * 1024 * 1024
+)
+
+type reporterTransport struct {
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func newReporterTransport(modifiers map[string]string) (*reporterTransport, error) {
+	t := &reporterTransport{
+		timeout:    reporterDefaultTimeout,
+		retryDelay: reporterDefaultRetryDelay,
+		tlsConfig:  &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	var err error
+	if timeoutStr, ok := modifiers["timeout"]; ok {
+		if t.timeout, err = time.ParseDuration(timeoutStr); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	if retriesStr, ok := modifiers["retries"]; ok {
+		if t.retries, err = strconv.Atoi(retriesStr); err != nil || t.retries < 0 {
+			return nil, fmt.Errorf("invalid retries %q", retriesStr)
+		}
+	}
+	if retryDelayStr, ok := modifiers["retryDelay"]; ok {
+		if t.retryDelay, err = time.ParseDuration(retryDelayStr); err != nil {
+			return nil, fmt.Errorf("invalid retry delay: %w", err)
+		}
+	}
+	if caFilePath, ok := modifiers["caFile"]; ok {
+		caData, err := os.ReadFile(caFilePath) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		if t.tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil {
+			t.tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !t.tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+	}
+	t.tlsConfig.InsecureSkipVerify = modifiers["insecureSkipVerify"] == "true" //nolint:gosec
+	httpTransport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   t.tlsConfig,
+		ForceAttemptHTTP2: true,
+	}
+	if proxy, ok := modifiers["proxy"]; ok {
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		httpTransport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	t.httpClient = &http.Client{Timeout: t.timeout, Transport: httpTransport}
+	return t, nil
+}
+
+func (t *reporterTransport) retry(attempt func() error) error {
+	delay := t.retryDelay
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if _, ok := errors.AsType[*permanentError](err); ok || i >= t.retries {
+			if i > 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, i+1)
+			}
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func newRequest(method string, endpoint string, contentType string, body string) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, endpoint, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	if bodyReader != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func (t *reporterTransport) send(req *http.Request) error {
+	return t.retry(func() error {
+		attemptReq := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return &permanentError{err: fmt.Errorf("get body: %w", err)}
+			}
+			attemptReq.Body = body
+		}
+		resp, err := t.httpClient.Do(attemptReq)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxRespBodyBytes))
+			err := fmt.Errorf("HTTP %d, %#v, %s", resp.StatusCode, resp.Header, string(bodyBytes))
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+				return &permanentError{err: err}
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func (t *reporterTransport) sendSimple(method string, endpoint string, body string) error {
+	req, err := newRequest(method, endpoint, "text/plain; charset=utf-8", body)
+	if err != nil {
+		return err
+	}
+	return t.send(req)
+}
+
+type uptimeKumaReporter struct {
+	endpoint  string
+	transport *reporterTransport
+}
+
+func (u *uptimeKumaReporter) start() error {
+	return nil
+}
+
+func (u *uptimeKumaReporter) end(result runResult) error {
+	var status, msg string
+	if len(result.errMsgs) > 0 {
+		status = "down"
+		msg = strings.Join(result.errMsgs, "\n")
+	} else {
+		status = "up"
+		msg = "Finished successfully"
+	}
+	return u.transport.sendSimple(http.MethodGet, fmt.Sprintf("%s?status=%s&msg=%s&ping=%d", u.endpoint, status, url.QueryEscape(msg), result.elapsed.Milliseconds()), "")
+}
+
+type healthchecksReporter struct {
+	endpoint     string
+	exitCodePing bool
+	transport    *reporterTransport
+}
+
+func (h *healthchecksReporter) start() error {
+	return h.transport.sendSimple(http.MethodPost, h.endpoint+"/start", "")
+}
+
+func (h *healthchecksReporter) end(result runResult) error {
+	endpoint := h.endpoint
+	if h.exitCodePing {
+		exitCode := result.exitCode
+		if exitCode < 0 || exitCode > 255 {
+			exitCode = 1
+		}
+		endpoint += "/" + strconv.Itoa(exitCode)
+	} else if len(result.errMsgs) > 0 {
+		endpoint += "/fail"
+	}
+	return h.transport.sendSimple(http.MethodPost, endpoint, result.logTail)
+}
@@ -0,0 +1,211 @@
+package runner
+
+import (
+	"autoshell/config"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReporterTransport(t *testing.T) {
+	result := runResult{workflow: "main", elapsed: time.Second, errMsgs: []string{"Failed commands: a"}, logTail: "log tail"}
+	t.Run("Unreachable Endpoint", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		entry, err := newReporterEntry("uptimeKuma", server.URL, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err == nil {
+			t.Error("expected unreachable endpoint to fail")
+		}
+	})
+	t.Run("Retry With Backoff", func(t *testing.T) {
+		var attempts atomic.Int32
+		var lastBody atomic.Value
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			lastBody.Store(string(body))
+			if attempts.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+		entry, err := newReporterEntry("healthchecks", server.URL, map[string]string{"retries": "2", "retryDelay": "1ms"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if attempts.Load() != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts.Load())
+		}
+		if lastBody.Load() != result.logTail {
+			t.Errorf("expected body to be resent on retry, got %q", lastBody.Load())
+		}
+	})
+	t.Run("No Retry On Client Error", func(t *testing.T) {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		entry, err := newReporterEntry("uptimeKuma", server.URL, map[string]string{"retries": "3", "retryDelay": "1ms"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err == nil || !strings.Contains(err.Error(), "HTTP 400") {
+			t.Errorf("expected HTTP 400 error, got %v", err)
+		}
+		if attempts.Load() != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts.Load())
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+		entry, err := newReporterEntry("uptimeKuma", server.URL, map[string]string{"timeout": "20ms"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err == nil {
+			t.Error("expected slow endpoint to time out")
+		}
+	})
+	t.Run("TLS", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		defer server.Close()
+		entry, err := newReporterEntry("uptimeKuma", server.URL, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err == nil {
+			t.Error("expected untrusted certificate to be rejected")
+		}
+		caFilePath := filepath.Join(t.TempDir(), "ca.pem")
+		caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		if err := os.WriteFile(caFilePath, caData, 0o600); err != nil {
+			t.Fatalf("write CA file: %v", err)
+		}
+		for _, modifiers := range []map[string]string{{"caFile": caFilePath}, {"insecureSkipVerify": "true"}} {
+			entry, err := newReporterEntry("uptimeKuma", server.URL, modifiers)
+			if err != nil {
+				t.Fatalf("new reporter: %v", err)
+			}
+			if err := entry.end(result); err != nil {
+				t.Errorf("end with %v: %v", modifiers, err)
+			}
+		}
+	})
+	t.Run("Proxy", func(t *testing.T) {
+		var proxiedUrl atomic.Value
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			proxiedUrl.Store(req.URL.String())
+		}))
+		defer proxy.Close()
+		entry, err := newReporterEntry("uptimeKuma", "http://uptime-kuma.invalid/api/push/abc", map[string]string{"proxy": proxy.URL})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if proxied, _ := proxiedUrl.Load().(string); !strings.HasPrefix(proxied, "http://uptime-kuma.invalid/api/push/abc?status=down") {
+			t.Errorf("expected request to go through the proxy, got %q", proxied)
+		}
+	})
+	t.Run("Invalid Options", func(t *testing.T) {
+		for _, modifiers := range []map[string]string{
+			{"timeout": "soon"},
+			{"retries": "-1"},
+			{"retryDelay": "1"},
+			{"caFile": filepath.Join(t.TempDir(), "missing.pem")},
+			{"scope": "workflow"},
+			{"scope": "command:["},
+		} {
+			if _, err := newReporterEntry("uptimeKuma", "http://localhost", modifiers); err == nil {
+				t.Errorf("expected %v to be rejected", modifiers)
+			}
+		}
+	})
+}
+
+func TestHealthchecksReporter(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+	success := runResult{workflow: "main", logTail: "all good"}
+	failure := runResult{workflow: "main", errMsgs: []string{"Failed commands: a"}, exitCode: 3, logTail: "exit status 3"}
+	for _, tc := range []struct {
+		modifiers map[string]string
+		result    runResult
+		expected  []string
+	}{
+		{map[string]string{}, success, []string{"POST /ping/abc/start ", "POST /ping/abc all good"}},
+		{map[string]string{}, failure, []string{"POST /ping/abc/start ", "POST /ping/abc/fail exit status 3"}},
+		{map[string]string{"exitCode": "true"}, success, []string{"POST /ping/abc/start ", "POST /ping/abc/0 all good"}},
+		{map[string]string{"exitCode": "true"}, failure, []string{"POST /ping/abc/start ", "POST /ping/abc/3 exit status 3"}},
+		{map[string]string{"exitCode": "true"}, runResult{errMsgs: []string{"not found"}, exitCode: -1}, []string{"POST /ping/abc/start ", "POST /ping/abc/1 "}},
+	} {
+		requests = nil
+		entry, err := newReporterEntry("healthchecks", server.URL+"/ping/abc/", tc.modifiers)
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		if err := entry.end(tc.result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		if !slices.Equal(requests, tc.expected) {
+			t.Errorf("expected requests %q with %v, got %q", tc.expected, tc.modifiers, requests)
+		}
+	}
+}
+
+func TestCommandReporters(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.URL.Path)
+	}))
+	defer server.Close()
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"addReporter!scope=command:db-*,exitCode healthchecks " + server.URL + "/db",
+			"addReporter!scope=command healthchecks " + server.URL + "/all",
+			"setIgnoredExitCodes [3]",
+			"runShell db-dump 'exit 0'",
+			"runShell db-ignored 'exit 3'",
+			"runShell cleanup 'exit 0'",
+			"runShell!ignoreFailures db-check 'exit 4'",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	expected := []string{
+		"/db/start", "/all/start", "/db/0", "/all",
+		"/db/start", "/all/start", "/db/0", "/all",
+		"/all/start", "/all",
+		"/db/start", "/all/start", "/db/0", "/all",
+	}
+	if !slices.Equal(requests, expected) {
+		t.Errorf("expected requests %q, got %q", expected, requests)
+	}
+}
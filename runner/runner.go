@@ -5,50 +5,66 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"maps"
-	"net/http"
-	"net/url"
-	"os"
-	"os/exec"
 	"runtime"
-	"slices"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Runner struct {
-	config           config.Config
-	vars             map[string]string
-	failedCommands   []string
-	ignoredExitCodes []int
-	logFilePath      string
-	logFileBuffer    strings.Builder
-	reporters        []reporter
-	httpClient       http.Client
+	config               config.Config
+	vars                 map[string]string
+	overriddenVars       map[string]bool
+	overriddenEnvVars    map[string]bool
+	env                  map[string]string
+	secrets              []string
+	runId                string
+	workflow             string
+	failedCommands       []string
+	commandResults       []commandResult
+	lastFailedExitCode   int
+	ignoredExitCodes     []int
+	consoleLogFormat     string
+	fileLogFormat        string
+	logOptions           logOptions
+	logFile              *rotatingFile
+	logFileBuffer        []logEvent
+	logFileBufferBytes   int
+	logFileBufferDropped int
+	logTail              tailBuffer
+	logSinks             []logSinkEntry
+	logMutex             sync.Mutex
+	reporters            []reporterEntry
 }
 
-type reporter struct {
-	kind     string
-	endpoint string
-}
+const logTailMaxBytes = 64 * 1024
 
 func New(cfg config.Config) *Runner {
 	return &Runner{
-		config:     cfg,
-		vars:       make(map[string]string),
-		httpClient: http.Client{Timeout: 10 * time.Second},
+		config:            cfg,
+		vars:              make(map[string]string),
+		overriddenVars:    make(map[string]bool),
+		overriddenEnvVars: make(map[string]bool),
+		env:               processEnv(),
+		runId:             newUuid(),
+		consoleLogFormat:  logFormatHuman,
+		fileLogFormat:     logFormatHuman,
+		logTail:           tailBuffer{maxLen: logTailMaxBytes},
 	}
 }
 
 func (r *Runner) RunWorkflow(args []string) error {
 	start := time.Now()
-	r.log("Started at %s", start.Format(time.RFC3339Nano))
-	err := r.runAction("runWorkflow", args, map[string]string{}, map[string]string{})
+	defer r.closeLogFile()
+	defer r.closeLogSinks()
+	if len(args) > 0 {
+		r.workflow = args[0]
+	}
+	r.logEvent(logEvent{Time: start, Event: eventRunStart, Message: "Started at " + start.Format(time.RFC3339Nano)})
+	err := r.runAction("runWorkflow", args, newRootScope(), map[string]string{})
 	end := time.Now()
 	elapsed := end.Sub(start)
-	r.log("Ended at %s after %dms", end.Format(time.RFC3339Nano), elapsed.Milliseconds())
 	var errMsgs []string
 	if len(r.failedCommands) > 0 {
 		errMsgs = append(errMsgs, "Failed commands: "+strings.Join(r.failedCommands, ", "))
@@ -56,76 +72,45 @@ func (r *Runner) RunWorkflow(args []string) error {
 	if err != nil {
 		errMsgs = append(errMsgs, err.Error())
 	}
-	r.report(elapsed, errMsgs)
-	defer r.log("")
+	exitCode := 0
 	if len(errMsgs) > 0 {
-		r.log("%s", strings.Join(errMsgs, "\n"))
-		return errors.New("runner failed")
-	}
-	return nil
-}
-
-func (r *Runner) log(format string, args ...any) {
-	text := strings.Repeat("-", 80) + "\n"
-	if format != "" {
-		if line := fmt.Sprintf(format, args...); line != "" {
-			text += line + "\n"
+		exitCode = r.lastFailedExitCode
+		if exitCode == 0 {
+			exitCode = 1
 		}
 	}
-	fmt.Print(text)
-	if r.logFilePath != "" {
-		if err := r.appendToLogFile(text); err != nil {
-			fmt.Println("Failed to write to log file: " + err.Error())
-		}
-	} else {
-		r.logFileBuffer.WriteString(text)
+	r.logEvent(logEvent{
+		Time:       end,
+		Event:      eventRunEnd,
+		ExitCode:   new(exitCode),
+		DurationMs: new(elapsed.Milliseconds()),
+		Message:    fmt.Sprintf("Ended at %s after %dms", end.Format(time.RFC3339Nano), elapsed.Milliseconds()),
+	})
+	if len(r.commandResults) > 0 {
+		r.log("%s", formatSummary(r.commandResults, elapsed))
 	}
-}
-
-func (r *Runner) appendToLogFile(text string) error {
-	file, err := os.OpenFile(r.logFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
-	if err != nil {
-		return fmt.Errorf("open file: %w", err)
+	if len(errMsgs) > 0 {
+		r.logError("%s", strings.Join(errMsgs, "\n"))
 	}
-	defer file.Close()
-	if _, err = file.WriteString(text); err != nil {
-		return fmt.Errorf("write to file: %w", err)
+	r.report(runResult{
+		workflow: r.workflow,
+		end:      end,
+		elapsed:  elapsed,
+		err:      err,
+		errMsgs:  errMsgs,
+		exitCode: exitCode,
+		commands: r.commandResults,
+		logTail:  r.logTail.String(),
+		readLog:  r.readRunLog,
+	})
+	r.log("")
+	if len(errMsgs) > 0 {
+		return errors.New("runner failed")
 	}
 	return nil
 }
 
-const maxRespBodyBytes = 8 * 1024 * 1024
-
-func (r *Runner) report(elapsed time.Duration, errMsgs []string) {
-	for _, reporter := range r.reporters {
-		var err error
-		switch reporter.kind {
-		case "uptimeKuma":
-			var status, msg string
-			if len(errMsgs) > 0 {
-				status = "down"
-				msg = strings.Join(errMsgs, "\n")
-			} else {
-				status = "up"
-				msg = "Finished successfully"
-			}
-			var resp *http.Response
-			resp, err = r.httpClient.Get(fmt.Sprintf("%s?status=%s&msg=%s&ping=%d", reporter.endpoint, status, url.QueryEscape(msg), elapsed.Milliseconds()))
-			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusOK {
-				bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxRespBodyBytes))
-				err = fmt.Errorf("HTTP %d, %#v, %s", resp.StatusCode, resp.Header, string(bodyBytes))
-			}
-		default:
-			err = errors.New("invalid kind")
-		}
-		if err != nil {
-			r.log("Reporter %q failed: %s", reporter.kind, err)
-		}
-	}
-}
-
-func (r *Runner) runAction(action string, args []string, vars map[string]string, modifiers map[string]string) error {
+func (r *Runner) runAction(action string, args []string, s *scope, modifiers map[string]string) error {
 	if action == "" || action[0] == '#' {
 		return nil
 	}
@@ -136,16 +121,29 @@ func (r *Runner) runAction(action string, args []string, vars map[string]string,
 			break
 		}
 		workflow := args[0]
-		instructions, ok := r.config.Workflows[workflow]
+		wf, ok := r.config.Workflows[workflow]
 		if !ok {
 			err = fmt.Errorf("workflow %q not found", workflow)
 			break
 		}
 		args := args[1:]
-		vars := maps.Clone(vars)
+		s := s.clone()
+		if err = bindParams(wf.Params, args, s.vars); err != nil {
+			err = fmt.Errorf("workflow %q: %w", workflow, err)
+			break
+		}
+		var instructions []instruction
+		if instructions, err = splitInstructions(wf.Instructions); err != nil {
+			err = fmt.Errorf("workflow %q: %w", workflow, err)
+			break
+		}
 	instLoop:
-		for instruction := range strings.SplitSeq(instructions, "\n") {
-			tokens := r.tokenise(instruction, args, vars)
+		for _, instruction := range instructions {
+			tokens, tokeniseErr := r.tokenise(instruction, args, s)
+			if tokeniseErr != nil && err == nil {
+				err = fmt.Errorf("workflow %q: line %d: %w", workflow, instruction.line, tokeniseErr)
+				continue
+			}
 			if len(tokens) == 0 {
 				continue
 			}
@@ -158,10 +156,12 @@ func (r *Runner) runAction(action string, args []string, vars map[string]string,
 					switch modifier {
 					case "W":
 						if runtime.GOOS != "windows" {
+							r.skipCommand(action, tokens)
 							continue instLoop
 						}
 					case "L":
 						if runtime.GOOS != "linux" {
+							r.skipCommand(action, tokens)
 							continue instLoop
 						}
 					}
@@ -169,9 +169,16 @@ func (r *Runner) runAction(action string, args []string, vars map[string]string,
 					if !found {
 						v = "true"
 					}
+					if prev, ok := modifiers[k]; ok && k == "env" {
+						v = prev + "\n" + v
+					}
 					modifiers[k] = v
 				}
 			}
+			if err != nil {
+				r.skipCommand(action, tokens)
+				continue
+			}
 			if action == "shiftArgs" {
 				argsLen := len(args)
 				if argsLen > 0 {
@@ -182,85 +189,181 @@ func (r *Runner) runAction(action string, args []string, vars map[string]string,
 				}
 				continue
 			}
-			if err = r.runAction(action, tokens[1:], vars, modifiers); err != nil {
-				break
-			}
+			err = r.runAction(action, tokens[1:], s, modifiers)
 		}
 	case "setEnvVar":
 		if err = checkArgsExact(args, 2); err != nil {
 			break
 		}
-		err = os.Setenv(args[0], args[1])
+		if r.overriddenEnvVars[envKey(args[0])] {
+			break
+		}
+		r.env[envKey(args[0])] = args[1]
+	case "setLocalEnvVar":
+		if err = checkArgsExact(args, 2); err != nil {
+			break
+		}
+		if r.overriddenEnvVars[envKey(args[0])] {
+			break
+		}
+		s.env[envKey(args[0])] = args[1]
+	case "unsetEnvVar":
+		if err = checkArgsExact(args, 1); err != nil {
+			break
+		}
+		if r.overriddenEnvVars[envKey(args[0])] {
+			break
+		}
+		delete(r.env, envKey(args[0]))
+		delete(s.env, envKey(args[0]))
+	case "loadEnvFile":
+		if err = checkArgsExact(args, 1); err != nil {
+			break
+		}
+		var entries [][2]string
+		if entries, err = readEnvFile(s.resolvePath(args[0])); err != nil {
+			break
+		}
+		for _, entry := range entries {
+			if modifiers["secret"] == "true" {
+				r.addSecret(entry[1])
+			}
+			if !r.overriddenEnvVars[envKey(entry[0])] {
+				r.env[envKey(entry[0])] = entry[1]
+			}
+		}
+	case "setVarFromFile", "setEnvVarFromFile":
+		if err = checkArgsExact(args, 2); err != nil {
+			break
+		}
+		var value string
+		if value, err = readValueFile(s.resolvePath(args[1])); err != nil {
+			break
+		}
+		if modifiers["secret"] == "true" {
+			r.addSecret(value)
+		}
+		if action == "setVarFromFile" {
+			if !r.overriddenVars[args[0]] {
+				r.vars[args[0]] = value
+			}
+		} else if !r.overriddenEnvVars[envKey(args[0])] {
+			r.env[envKey(args[0])] = value
+		}
 	case "setGlobalVar":
 		if err = checkArgsExact(args, 2); err != nil {
 			break
 		}
+		if r.overriddenVars[args[0]] {
+			break
+		}
 		r.vars[args[0]] = args[1]
 	case "setLocalVar":
 		if err = checkArgsExact(args, 2); err != nil {
 			break
 		}
-		vars[args[0]] = args[1]
+		s.vars[args[0]] = args[1]
 	case "runCommand":
+		var options commandOptions
+		if options, args, err = r.commandOptions(s, args, modifiers); err != nil {
+			break
+		}
 		if err = checkArgsMin(args, 2); err != nil {
 			break
 		}
-		commandId := args[0]
-		retries := 0
-		if retriesStr, ok := modifiers["retries"]; ok {
-			retries, _ = strconv.Atoi(retriesStr)
+		r.runCommand(action, args[0], modifiers, options.withStdio(execCommand(args[1], args[2:], options)))
+	case "runPipeline":
+		var options commandOptions
+		if options, args, err = r.commandOptions(s, args, modifiers); err != nil {
+			break
 		}
-		var cmdErr error
-		for i := 0; i <= retries; i++ {
-			if i > 0 {
-				r.log("Retrying (%d/%d)", i, retries)
-			} else if modifiers["hideCommandId"] != "true" {
-				r.log("Command ID: %s", commandId)
-			}
-			cmd := exec.Command(args[1], args[2:]...) //nolint:gosec
-			if r.logFilePath != "" {
-				var output []byte
-				output, cmdErr = cmd.CombinedOutput()
-				r.log("%s", strings.TrimSuffix(string(output), "\n"))
-			} else {
-				r.log("")
-				cmd.Stdout = os.Stdout
-				cmd.Stdin = os.Stdin
-				cmd.Stderr = os.Stderr
-				cmdErr = cmd.Run()
-			}
-			if cmdErr == nil {
-				break
-			}
-			if exitError, ok := errors.AsType[*exec.ExitError](cmdErr); ok {
-				if slices.Contains(r.ignoredExitCodes, exitError.ExitCode()) {
-					break
-				}
-			}
-			r.log("%s failed: %s", action, cmdErr)
-			if i < retries {
-				continue
-			}
-			if modifiers["ignoreFailures"] != "true" {
-				r.failedCommands = append(r.failedCommands, commandId)
-			}
+		if err = checkArgsMin(args, 2); err != nil {
+			break
+		}
+		var stages [][]string
+		if stages, err = splitPipeline(args[1:]); err != nil {
+			break
+		}
+		r.runCommand(action, args[0], modifiers, options.withStdio(pipelineCommand(stages, options)))
+	case "runShell":
+		var options commandOptions
+		if options, args, err = r.commandOptions(s, args, modifiers); err != nil {
+			break
+		}
+		if err = checkArgsExact(args, 2); err != nil {
+			break
 		}
+		var run func(stdio commandIO) error
+		if run, err = shellCommand(args[0], args[1], options); err != nil {
+			break
+		}
+		r.runCommand(action, args[0], modifiers, options.withStdio(run))
+	case "setWorkDir":
+		if err = checkArgsExact(args, 1); err != nil {
+			break
+		}
+		err = s.setWorkDir(args[0])
+	case "pushDir":
+		if err = checkArgsExact(args, 1); err != nil {
+			break
+		}
+		err = s.pushDir(args[0])
+	case "popDir":
+		if err = checkArgsExact(args, 0); err != nil {
+			break
+		}
+		err = s.popDir()
 	case "setLogFile":
 		if err = checkArgsExact(args, 1); err != nil {
 			break
 		}
-		r.logFilePath = args[0]
-		err = r.appendToLogFile(r.logFileBuffer.String())
-		if err != nil {
-			r.logFilePath = ""
-		} else {
-			r.logFileBuffer.Reset()
+		err = r.openLogFile(s.resolvePath(args[0]), modifiers)
+	case "setLogFormat":
+		if err = checkArgsMin(args, 1); err != nil {
+			break
+		}
+		if err = checkArgsMax(args, 2); err != nil {
+			break
+		}
+		target := logTargetAll
+		if len(args) == 2 {
+			target = args[1]
+		}
+		err = r.setLogFormat(args[0], target)
+	case "setLogOptions":
+		if err = checkArgsMin(args, 1); err != nil {
+			break
 		}
+		err = r.setLogOptions(args)
 	case "addReporter":
 		if err = checkArgsExact(args, 2); err != nil {
 			break
 		}
-		r.reporters = append(r.reporters, reporter{kind: args[0], endpoint: args[1]})
+		var entry reporterEntry
+		endpoint, reporterModifiers := resolveReporterPaths(args[0], args[1], modifiers, s)
+		if entry, err = newReporterEntry(args[0], endpoint, reporterModifiers); err != nil {
+			break
+		}
+		r.reporters = append(r.reporters, entry)
+		if entry.scope == reporterScopeRun {
+			if startErr := entry.start(); startErr != nil {
+				r.logError("Reporter %q failed: %s", entry.kind, startErr)
+			}
+		}
+	case "addLogSink":
+		if err = checkArgsMin(args, 1); err != nil {
+			break
+		}
+		if err = checkArgsMax(args, 2); err != nil {
+			break
+		}
+		var sink logSink
+		if sink, err = newLogSink(args[0], args[1:], modifiers); err != nil {
+			break
+		}
+		r.logMutex.Lock()
+		r.logSinks = append(r.logSinks, logSinkEntry{kind: args[0], logSink: sink})
+		r.logMutex.Unlock()
 	case "setIgnoredExitCodes":
 		if err = checkArgsExact(args, 1); err != nil {
 			break
@@ -284,81 +387,16 @@ func checkArgsExact(args []string, expected int) error {
 	return nil
 }
 
-func checkArgsMin(args []string, expected int) error {
-	if len(args) < expected {
-		return fmt.Errorf("invalid number of args, expected at least %d, received %d", expected, len(args))
+func checkArgsMax(args []string, expected int) error {
+	if len(args) > expected {
+		return fmt.Errorf("invalid number of args, expected at most %d, received %d", expected, len(args))
 	}
 	return nil
 }
 
-const varPrefix = "$"
-
-func (r *Runner) tokenise(instruction string, args []string, vars map[string]string) []string {
-	argVars := make(map[string]string)
-	argsQuoted := make([]string, len(args))
-	for i, arg := range args {
-		argVars[strconv.Itoa(i+1)] = arg
-		argsQuoted[i] = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
-	}
-	argVars["@"] = strings.Join(argsQuoted, " ")
-	instruction = os.Expand(instruction, func(k string) string {
-		if k == varPrefix {
-			return varPrefix
-		}
-		for _, varMap := range []map[string]string{argVars, vars, r.vars} {
-			if v, ok := varMap[k]; ok {
-				return v
-			}
-		}
-		return os.Getenv(k)
-	})
-	var tokens []string
-	var currentToken strings.Builder
-	var forceAppend bool
-	appendCurrentToken := func() {
-		if currentToken.Len() > 0 || forceAppend {
-			tokens = append(tokens, currentToken.String())
-			currentToken.Reset()
-			forceAppend = false
-		}
-	}
-	var escaped, inSingleQuote, inDoubleQuote bool
-	for _, char := range instruction {
-		if escaped {
-			escaped = false
-			if char == '\\' || char == '\'' || char == '"' {
-				currentToken.WriteRune(char)
-				continue
-			}
-			currentToken.WriteRune('\\')
-		}
-		switch char {
-		case '\\':
-			escaped = true
-		case '\'':
-			if inDoubleQuote {
-				currentToken.WriteRune(char)
-			} else {
-				inSingleQuote = !inSingleQuote
-			}
-			forceAppend = true
-		case '"':
-			if inSingleQuote {
-				currentToken.WriteRune(char)
-			} else {
-				inDoubleQuote = !inDoubleQuote
-			}
-			forceAppend = true
-		case ' ':
-			if inSingleQuote || inDoubleQuote {
-				currentToken.WriteRune(char)
-			} else {
-				appendCurrentToken()
-			}
-		default:
-			currentToken.WriteRune(char)
-		}
+func checkArgsMin(args []string, expected int) error {
+	if len(args) < expected {
+		return fmt.Errorf("invalid number of args, expected at least %d, received %d", expected, len(args))
 	}
-	appendCurrentToken()
-	return tokens
+	return nil
 }
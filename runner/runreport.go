@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"autoshell/fileutil"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const runReportPerm = 0o644
+
+type junitReporter struct {
+	filePath string
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Hostname  string          `xml:"hostname,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+	SystemErr string          `xml:"system-err,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (j *junitReporter) start() error {
+	return nil
+}
+
+func (j *junitReporter) end(result runResult) error {
+	suite := junitTestSuite{
+		Name:      result.workflow,
+		Tests:     len(result.commands),
+		Time:      formatJunitSeconds(result.elapsed),
+		Timestamp: result.end.Add(-result.elapsed).Format(time.RFC3339),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		suite.Hostname = hostname
+	}
+	for _, command := range result.commands {
+		testCase := junitTestCase{Name: command.id, Classname: result.workflow, Time: formatJunitSeconds(command.duration)}
+		switch command.status {
+		case commandStatusFailed:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: fmt.Sprintf("exit code %d after %d attempts", command.exitCode, command.attempts), Text: command.output}
+		case commandStatusIgnored:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: fmt.Sprintf("failure ignored, exit code %d", command.exitCode)}
+			testCase.SystemOut = command.output
+		case commandStatusSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: "not run"}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if result.err != nil {
+		suite.Errors++
+		suite.SystemErr = result.err.Error()
+	}
+	return fileutil.AtomicWrite(j.filePath, runReportPerm, func(file *os.File) error {
+		if _, err := file.WriteString(xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(file)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+			return err
+		}
+		_, err := file.WriteString("\n")
+		return err
+	})
+}
+
+func formatJunitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+type jsonReporter struct {
+	filePath string
+}
+
+type jsonReport struct {
+	Workflow   string              `json:"workflow"`
+	Status     string              `json:"status"`
+	Start      time.Time           `json:"start"`
+	End        time.Time           `json:"end"`
+	DurationMs int64               `json:"durationMs"`
+	ExitCode   int                 `json:"exitCode"`
+	Errors     []string            `json:"errors"`
+	Commands   []jsonReportCommand `json:"commands"`
+}
+
+type jsonReportCommand struct {
+	Id         string `json:"id"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	ExitCode   int    `json:"exitCode"`
+	DurationMs int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"`
+}
+
+func (j *jsonReporter) start() error {
+	return nil
+}
+
+func (j *jsonReporter) end(result runResult) error {
+	report := jsonReport{
+		Workflow:   result.workflow,
+		Status:     commandStatusOk,
+		Start:      result.end.Add(-result.elapsed),
+		End:        result.end,
+		DurationMs: result.elapsed.Milliseconds(),
+		ExitCode:   result.exitCode,
+		Errors:     append([]string{}, result.errMsgs...),
+		Commands:   []jsonReportCommand{},
+	}
+	if len(result.errMsgs) > 0 {
+		report.Status = commandStatusFailed
+	}
+	for _, command := range result.commands {
+		report.Commands = append(report.Commands, jsonReportCommand{
+			Id:         command.id,
+			Status:     command.status,
+			Attempts:   command.attempts,
+			ExitCode:   command.exitCode,
+			DurationMs: command.duration.Milliseconds(),
+			Output:     command.output,
+		})
+	}
+	return fileutil.AtomicWrite(j.filePath, runReportPerm, func(file *os.File) error {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	})
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	result := runResult{
+		workflow: "deploy",
+		end:      time.Date(2025, 5, 30, 20, 36, 20, 0, time.UTC),
+		elapsed:  3 * time.Second,
+		err:      errors.New("runWorkflow: workflow \"smoke\" not found"),
+		errMsgs:  []string{"Failed commands: migrate"},
+		exitCode: 2,
+		commands: []commandResult{
+			{id: "build", status: commandStatusRetried, attempts: 2, duration: 2 * time.Second},
+			{id: "migrate", status: commandStatusFailed, attempts: 1, exitCode: 2, duration: time.Second, output: "relation already exists\n"},
+			{id: "lint", status: commandStatusIgnored, attempts: 1, exitCode: 1, output: "1 warning\n"},
+			{id: "notify", status: commandStatusSkipped},
+		},
+	}
+	t.Run("JUnit", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "report.xml")
+		entry, err := newReporterEntry("junit", filePath, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("read report: %v", err)
+		}
+		var report junitTestSuites
+		if err := xml.Unmarshal(data, &report); err != nil {
+			t.Fatalf("parse report: %v", err)
+		}
+		if len(report.Suites) != 1 {
+			t.Fatalf("expected 1 test suite, got %d", len(report.Suites))
+		}
+		suite := report.Suites[0]
+		if suite.Name != "deploy" || suite.Tests != 4 || suite.Failures != 1 || suite.Skipped != 2 || suite.Errors != 1 || suite.Time != "3.000" {
+			t.Errorf("unexpected test suite %+v", suite)
+		}
+		if testCase := suite.Cases[1]; testCase.Failure == nil || testCase.Failure.Text != "relation already exists\n" {
+			t.Errorf("expected failed command to include its output, got %+v", testCase)
+		}
+		if testCase := suite.Cases[2]; testCase.Skipped == nil || testCase.SystemOut != "1 warning\n" {
+			t.Errorf("expected ignored command to be skipped with its output, got %+v", testCase)
+		}
+		if testCase := suite.Cases[0]; testCase.Failure != nil || testCase.Skipped != nil || testCase.Time != "2.000" {
+			t.Errorf("expected retried command to pass, got %+v", testCase)
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "report.json")
+		entry, err := newReporterEntry("json", filePath, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := entry.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("read report: %v", err)
+		}
+		var report jsonReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatalf("parse report: %v", err)
+		}
+		if report.Status != commandStatusFailed || report.ExitCode != 2 || report.DurationMs != 3000 || len(report.Commands) != 4 {
+			t.Errorf("unexpected report %+v", report)
+		}
+		if command := report.Commands[1]; command.Id != "migrate" || command.Status != commandStatusFailed || command.Output != "relation already exists\n" {
+			t.Errorf("unexpected command %+v", command)
+		}
+		if !report.Start.Equal(time.Date(2025, 5, 30, 20, 36, 17, 0, time.UTC)) {
+			t.Errorf("unexpected start %s", report.Start)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"strings"
+)
+
+const (
+	secretMask         = "***"
+	secretMinMaskBytes = 4
+)
+
+func (r *Runner) addSecret(value string) {
+	r.logMutex.Lock()
+	defer r.logMutex.Unlock()
+	for line := range strings.Lines(value) {
+		line = strings.TrimSpace(line)
+		if len(line) >= secretMinMaskBytes {
+			r.secrets = append(r.secrets, line)
+		}
+	}
+}
+
+func (r *Runner) maskSecrets(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, secretMask)
+	}
+	return s
+}
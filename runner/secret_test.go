@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"autoshell/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	keyFilePath := filepath.Join(dir, "b2_key")
+	if err := os.WriteFile(keyFilePath, []byte("K005abcdef\r\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	envFilePath := filepath.Join(dir, "restic.env")
+	if err := os.WriteFile(envFilePath, []byte("export RESTIC_PASSWORD='correct horse'\nRESTIC_REPOSITORY=rclone::b2:restic\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setVarFromFile!secret b2Key " + keyFilePath,
+			"setEnvVarFromFile RCLONE_B2_KEY " + keyFilePath,
+			"loadEnvFile!secret " + envFilePath,
+			`print key=$b2Key env=$RCLONE_B2_KEY password=$RESTIC_PASSWORD`,
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	if r.vars["b2Key"] != "K005abcdef" || r.env[envKey("RCLONE_B2_KEY")] != "K005abcdef" {
+		t.Errorf("expected trailing newline to be trimmed, got %q and %q", r.vars["b2Key"], r.env[envKey("RCLONE_B2_KEY")])
+	}
+	if r.env[envKey("RESTIC_REPOSITORY")] != "rclone::b2:restic" {
+		t.Errorf("expected env file to be loaded, got %q", r.env[envKey("RESTIC_REPOSITORY")])
+	}
+	if log := r.logTail.String(); !strings.Contains(log, "key=*** env=*** password=***\n") || strings.Contains(log, "K005abcdef") {
+		t.Errorf("expected secrets to be masked, got %q", log)
+	}
+}
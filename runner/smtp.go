@@ -0,0 +1,267 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	smtpTlsStartTls = "starttls"
+	smtpTlsImplicit = "implicit"
+	smtpTlsNone     = "none"
+)
+
+const (
+	smtpMaxAttachmentBytes  = 10 * 1024 * 1024
+	smtpAttachmentFileName  = "autoshell.log"
+	smtpDefaultPort         = "587"
+	smtpDefaultImplicitPort = "465"
+)
+
+type smtpReporter struct {
+	addr      string
+	host      string
+	tlsMode   string
+	username  string
+	password  string
+	from      *mail.Address
+	to        []*mail.Address
+	attachLog bool
+	notify    *notifyPolicy
+	transport *reporterTransport
+}
+
+func newSmtpReporter(endpoint string, modifiers map[string]string, transport *reporterTransport) (reporter, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	query := endpointUrl.Query()
+	s := &smtpReporter{
+		host:      endpointUrl.Hostname(),
+		attachLog: modifiers["attachLog"] == "true",
+		transport: transport,
+	}
+	port := endpointUrl.Port()
+	switch endpointUrl.Scheme {
+	case "smtp":
+		s.tlsMode = smtpTlsStartTls
+		if port == "" {
+			port = smtpDefaultPort
+		}
+	case "smtps":
+		s.tlsMode = smtpTlsImplicit
+		if port == "" {
+			port = smtpDefaultImplicitPort
+		}
+	default:
+		return nil, fmt.Errorf("invalid scheme %q", endpointUrl.Scheme)
+	}
+	if tlsMode := query.Get("tls"); tlsMode != "" {
+		if tlsMode != smtpTlsStartTls && tlsMode != smtpTlsImplicit && tlsMode != smtpTlsNone {
+			return nil, fmt.Errorf("invalid tls mode %q", tlsMode)
+		}
+		s.tlsMode = tlsMode
+	}
+	if s.host == "" {
+		return nil, errors.New("missing host")
+	}
+	s.addr = net.JoinHostPort(s.host, port)
+	if endpointUrl.User != nil {
+		s.username = endpointUrl.User.Username()
+		s.password, _ = endpointUrl.User.Password()
+	}
+	if s.from, err = mail.ParseAddress(query.Get("from")); err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	for _, toList := range query["to"] {
+		addresses, err := mail.ParseAddressList(toList)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to address: %w", err)
+		}
+		s.to = append(s.to, addresses...)
+	}
+	if len(s.to) == 0 {
+		return nil, errors.New("missing to address")
+	}
+	if s.notify, err = newNotifyPolicy("smtp", endpoint, modifiers); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *smtpReporter) start() error {
+	return nil
+}
+
+func (s *smtpReporter) end(result runResult) error {
+	shouldNotify, recovered, err := s.notify.check(result)
+	if err != nil {
+		return err
+	}
+	if !shouldNotify {
+		return s.notify.save(result)
+	}
+	message := formatChatMessage(result, recovered)
+	if result.command == "" && len(result.commands) > 0 {
+		message.body += "\n\n" + formatSummary(result.commands, result.elapsed)
+	}
+	var attachment []byte
+	if s.attachLog && result.readLog != nil {
+		if attachment, err = result.readLog(smtpMaxAttachmentBytes); err != nil {
+			return fmt.Errorf("read log: %w", err)
+		}
+	}
+	data, err := s.buildMessage(message, attachment)
+	if err != nil {
+		return fmt.Errorf("build message: %w", err)
+	}
+	if err := s.transport.retry(func() error {
+		return s.send(data)
+	}); err != nil {
+		return err
+	}
+	return s.notify.save(result)
+}
+
+func (s *smtpReporter) buildMessage(message chatMessage, attachment []byte) ([]byte, error) {
+	to := make([]string, len(s.to))
+	for i, address := range s.to {
+		to[i] = address.String()
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.title))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: <%s@%s>\r\n", rand.Text(), domainOf(s.from.Address))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if attachment == nil {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(buf, message.body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	bodyWriter := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", bodyWriter.Boundary())
+	parts := []struct {
+		header textproto.MIMEHeader
+		text   string
+	}{
+		{
+			header: textproto.MIMEHeader{
+				"Content-Type":              {"text/plain; charset=utf-8"},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			},
+			text: message.body,
+		},
+		{
+			header: textproto.MIMEHeader{
+				"Content-Type":              {"text/plain; charset=utf-8"},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+				"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": smtpAttachmentFileName})},
+			},
+			text: string(attachment),
+		},
+	}
+	for _, part := range parts {
+		partWriter, err := bodyWriter.CreatePart(part.header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(partWriter, part.text); err != nil {
+			return nil, err
+		}
+	}
+	if err := bodyWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *smtpReporter) send(data []byte) error {
+	tlsConfig := s.transport.tlsConfig.Clone()
+	tlsConfig.ServerName = s.host
+	dialer := &net.Dialer{Timeout: s.transport.timeout}
+	var conn net.Conn
+	var err error
+	if s.tlsMode == smtpTlsImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.transport.timeout))
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("new client: %w", err)
+	}
+	defer client.Close()
+	if s.tlsMode == smtpTlsStartTls {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("MAIL: %w", err)
+	}
+	for _, address := range s.to {
+		if err := client.Rcpt(address.Address); err != nil {
+			return fmt.Errorf("RCPT: %w", err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("write data: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	return client.Quit()
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qpWriter := quotedprintable.NewWriter(w)
+	if _, err := qpWriter.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qpWriter.Close()
+}
+
+func domainOf(address string) string {
+	if _, domain, found := strings.Cut(address, "@"); found {
+		return domain
+	}
+	return "autoshell"
+}
@@ -0,0 +1,185 @@
+package runner
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeSmtpServer struct {
+	listener net.Listener
+	messages chan fakeSmtpMessage
+}
+
+type fakeSmtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSmtpServer(t *testing.T) *fakeSmtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSmtpServer{listener: listener, messages: make(chan fakeSmtpMessage, 1)}
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *fakeSmtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSmtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+	var message fakeSmtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = text.PrintfLine("250 localhost")
+		case "MAIL":
+			message.from = arg
+			_ = text.PrintfLine("250 OK")
+		case "RCPT":
+			message.to = append(message.to, arg)
+			_ = text.PrintfLine("250 OK")
+		case "DATA":
+			_ = text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.messages <- message
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *fakeSmtpServer) receive(t *testing.T) fakeSmtpMessage {
+	t.Helper()
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return fakeSmtpMessage{}
+	}
+}
+
+func TestSmtpReporter(t *testing.T) {
+	server := newFakeSmtpServer(t)
+	endpoint := "smtp://" + server.listener.Addr().String() + "?tls=none&from=autoshell@example.com&to=ops@example.com,Backup%20Team%20%3Cbackup@example.com%3E"
+	result := runResult{
+		workflow: "main",
+		elapsed:  1500 * time.Millisecond,
+		errMsgs:  []string{"Failed commands: b2-backup-db"},
+		exitCode: 3,
+		commands: []commandResult{
+			{id: "create-sql-dump", status: commandStatusOk, attempts: 1, duration: time.Second},
+			{id: "b2-backup-db", duration: 500 * time.Millisecond, exitCode: 3, status: commandStatusFailed, attempts: 1},
+		},
+		readLog: func(maxBytes int64) ([]byte, error) {
+			return []byte("Command ID: b2-backup-db\nrepository not found\n"), nil
+		},
+	}
+	t.Run("Summary", func(t *testing.T) {
+		rep, err := newReporterEntry("smtp", endpoint, map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := rep.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		message := server.receive(t)
+		if message.from != "FROM:<autoshell@example.com>" {
+			t.Errorf("unexpected sender %q", message.from)
+		}
+		if len(message.to) != 2 || message.to[1] != "TO:<backup@example.com>" {
+			t.Errorf("unexpected recipients %q", message.to)
+		}
+		if !strings.Contains(message.data, "Subject: autoshell: main failed") {
+			t.Errorf("expected subject to contain the workflow status, got %q", message.data)
+		}
+		if !strings.Contains(message.data, "- b2-backup-db (500ms, exit code 3)") {
+			t.Errorf("expected body to contain the failed command, got %q", message.data)
+		}
+		if strings.Contains(message.data, "multipart/mixed") {
+			t.Error("expected no attachment")
+		}
+	})
+	t.Run("Log Attachment", func(t *testing.T) {
+		rep, err := newReporterEntry("smtp", endpoint, map[string]string{"attachLog": "true"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := rep.end(result); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		message := server.receive(t)
+		if !strings.Contains(message.data, `Content-Disposition: attachment; filename=autoshell.log`) {
+			t.Errorf("expected log attachment, got %q", message.data)
+		}
+		if !strings.Contains(message.data, "repository not found") {
+			t.Errorf("expected attachment to contain the log, got %q", message.data)
+		}
+	})
+	t.Run("Notify On Failure Only", func(t *testing.T) {
+		rep, err := newReporterEntry("smtp", endpoint, map[string]string{"notify": "failure"})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := rep.end(runResult{workflow: "main"}); err != nil {
+			t.Fatalf("end: %v", err)
+		}
+		select {
+		case <-server.messages:
+			t.Error("expected no message for a successful run")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+	t.Run("STARTTLS Required", func(t *testing.T) {
+		rep, err := newReporterEntry("smtp", strings.Replace(endpoint, "tls=none", "tls=starttls", 1), map[string]string{})
+		if err != nil {
+			t.Fatalf("new reporter: %v", err)
+		}
+		if err := rep.end(result); err == nil {
+			t.Error("expected failure when the server does not support STARTTLS")
+		}
+	})
+	t.Run("Invalid Endpoint", func(t *testing.T) {
+		for _, endpoint := range []string{
+			"http://localhost?from=a@example.com&to=b@example.com",
+			"smtp://localhost?to=b@example.com",
+			"smtp://localhost?from=a@example.com",
+			"smtp://localhost?from=a@example.com&to=b@example.com&tls=maybe",
+		} {
+			if _, err := newReporterEntry("smtp", endpoint, map[string]string{}); err == nil {
+				t.Errorf("expected %q to be rejected", endpoint)
+			}
+		}
+	})
+}
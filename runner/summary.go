@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	commandStatusOk      = "ok"
+	commandStatusFailed  = "failed"
+	commandStatusIgnored = "ignored"
+	commandStatusSkipped = "skipped"
+	commandStatusRetried = "retried"
+)
+
+var commandActions = []string{"runCommand", "runShell", "runPipeline"}
+
+type commandResult struct {
+	id       string
+	status   string
+	attempts int
+	duration time.Duration
+	exitCode int
+	output   string
+}
+
+func (c commandResult) failed() bool {
+	return c.status == commandStatusFailed
+}
+
+func (r *Runner) skipCommand(action string, tokens []string) {
+	if !slices.Contains(commandActions, action) || len(tokens) < 2 {
+		return
+	}
+	r.commandResults = append(r.commandResults, commandResult{id: tokens[1], status: commandStatusSkipped})
+}
+
+func formatSummary(commands []commandResult, elapsed time.Duration) string {
+	text := new(strings.Builder)
+	tw := tabwriter.NewWriter(text, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMMAND\tSTATUS\tATTEMPTS\tEXIT CODE\tDURATION")
+	counts := make(map[string]int)
+	var commandsDuration time.Duration
+	for _, command := range commands {
+		counts[command.status]++
+		commandsDuration += command.duration
+		if command.status == commandStatusSkipped {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\n", command.id, command.status)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", command.id, command.status, command.attempts, command.exitCode, command.duration.Round(time.Millisecond))
+	}
+	_ = tw.Flush()
+	var countStrs []string
+	for _, status := range []string{commandStatusOk, commandStatusRetried, commandStatusFailed, commandStatusIgnored, commandStatusSkipped} {
+		if counts[status] > 0 {
+			countStrs = append(countStrs, strconv.Itoa(counts[status])+" "+status)
+		}
+	}
+	fmt.Fprintf(text, "Total: %d commands", len(commands))
+	if len(countStrs) > 0 {
+		fmt.Fprintf(text, " (%s)", strings.Join(countStrs, ", "))
+	}
+	fmt.Fprintf(text, ", %s in commands, %s overall", commandsDuration.Round(time.Millisecond), elapsed.Round(time.Millisecond))
+	return text.String()
+}
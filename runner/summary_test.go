@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"autoshell/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSummary(t *testing.T) {
+	t.Run("Statuses", func(t *testing.T) {
+		r := New(config.Config{Workflows: map[string]config.Workflow{
+			"main": {Instructions: strings.Join([]string{
+				"runCommand!ignoreFailures,retries=1 a autoshell-missing-binary",
+				"runCommand b autoshell-missing-binary",
+				"unknownAction",
+				"runCommand c autoshell-missing-binary",
+			}, "\n")},
+		}})
+		if err := r.RunWorkflow([]string{"main"}); err == nil {
+			t.Fatal("expected workflow to fail")
+		}
+		expected := []commandResult{
+			{id: "a", status: commandStatusIgnored, attempts: 2, exitCode: -1},
+			{id: "b", status: commandStatusFailed, attempts: 1, exitCode: -1},
+			{id: "c", status: commandStatusSkipped},
+		}
+		if len(r.commandResults) != len(expected) {
+			t.Fatalf("expected %d command results, got %d", len(expected), len(r.commandResults))
+		}
+		for i, result := range r.commandResults {
+			result.duration = 0
+			result.output = ""
+			if result != expected[i] {
+				t.Errorf("expected %+v, got %+v", expected[i], result)
+			}
+		}
+	})
+	t.Run("Table", func(t *testing.T) {
+		summary := formatSummary([]commandResult{
+			{id: "create-sql-dump", status: commandStatusRetried, attempts: 2, duration: 1500 * time.Millisecond},
+			{id: "b2-backup-db", status: commandStatusFailed, attempts: 1, exitCode: 3, duration: 500 * time.Millisecond},
+			{id: "cleanup", status: commandStatusSkipped},
+		}, 2500*time.Millisecond)
+		expected := strings.Join([]string{
+			"COMMAND          STATUS   ATTEMPTS  EXIT CODE  DURATION",
+			"create-sql-dump  retried  2         0          1.5s",
+			"b2-backup-db     failed   1         3          500ms",
+			"cleanup          skipped  -         -          -",
+			"Total: 3 commands (1 retried, 1 failed, 1 skipped), 2s in commands, 2.5s overall",
+		}, "\n")
+		if summary != expected {
+			t.Errorf("unexpected summary:\n%s", summary)
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const varPrefix = "$"
+
+const heredocSentinel = "\x00"
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+type instruction struct {
+	line     int
+	text     string
+	heredocs []heredoc
+}
+
+type heredoc struct {
+	delimiter string
+	stripTabs bool
+	expand    bool
+	body      string
+}
+
+func splitInstructions(s string) ([]instruction, error) {
+	lines := strings.Split(s, "\n")
+	var instructions []instruction
+	for i := 0; i < len(lines); i++ {
+		inst := instruction{line: i + 1}
+		text := new(strings.Builder)
+		var inSingleQuote, inDoubleQuote bool
+		for {
+			line := strings.TrimSuffix(lines[i], "\r")
+			continued, err := scanLine(line, text, &inst.heredocs, &inSingleQuote, &inDoubleQuote)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if !continued {
+				break
+			}
+			if i+1 == len(lines) {
+				return nil, fmt.Errorf("line %d: line continuation at end of instructions", i+1)
+			}
+			i++
+		}
+		if inSingleQuote || inDoubleQuote {
+			return nil, fmt.Errorf("line %d: %w", inst.line, errUnterminatedQuote)
+		}
+		for j := range inst.heredocs {
+			h := &inst.heredocs[j]
+			var body []string
+			for {
+				i++
+				if i == len(lines) {
+					return nil, fmt.Errorf("line %d: heredoc %q not terminated", inst.line, h.delimiter)
+				}
+				line := strings.TrimSuffix(lines[i], "\r")
+				if h.stripTabs {
+					line = strings.TrimLeft(line, "\t")
+				}
+				if line == h.delimiter {
+					break
+				}
+				body = append(body, line)
+			}
+			h.body = strings.Join(body, "\n")
+		}
+		inst.text = text.String()
+		if strings.TrimSpace(inst.text) != "" {
+			instructions = append(instructions, inst)
+		}
+	}
+	return instructions, nil
+}
+
+func scanLine(line string, text *strings.Builder, heredocs *[]heredoc, inSingleQuote *bool, inDoubleQuote *bool) (bool, error) {
+	atTokenStart := func() bool {
+		s := text.String()
+		return s == "" || isSpace(rune(s[len(s)-1]))
+	}
+	for i := 0; i < len(line); i++ {
+		char := line[i]
+		inQuote := *inSingleQuote || *inDoubleQuote
+		switch {
+		case char == '\\':
+			if i+1 == len(line) {
+				return true, nil
+			}
+			text.WriteByte(char)
+			if next := line[i+1]; next == '\\' || next == '\'' || next == '"' {
+				text.WriteByte(next)
+				i++
+			}
+			continue
+		case char == '\'' && !*inDoubleQuote:
+			*inSingleQuote = !*inSingleQuote
+		case char == '"' && !*inSingleQuote:
+			*inDoubleQuote = !*inDoubleQuote
+		case char == '#' && !inQuote && atTokenStart():
+			return false, nil
+		case char == '<' && !inQuote && atTokenStart() && strings.HasPrefix(line[i:], "<<"):
+			h, n, err := parseHeredocMarker(line[i+2:])
+			if err != nil {
+				return false, err
+			}
+			text.WriteString(heredocSentinel + strconv.Itoa(len(*heredocs)) + heredocSentinel)
+			*heredocs = append(*heredocs, h)
+			i += 1 + n
+			continue
+		}
+		text.WriteByte(char)
+	}
+	return false, nil
+}
+
+func parseHeredocMarker(s string) (heredoc, int, error) {
+	h := heredoc{expand: true}
+	n := 0
+	if strings.HasPrefix(s, "-") {
+		h.stripTabs = true
+		n++
+	}
+	if n < len(s) && (s[n] == '\'' || s[n] == '"') {
+		end := strings.IndexByte(s[n+1:], s[n])
+		if end < 0 {
+			return heredoc{}, 0, errUnterminatedQuote
+		}
+		h.delimiter = s[n+1 : n+1+end]
+		h.expand = false
+		n += end + 2
+	} else {
+		end := strings.IndexFunc(s[n:], isSpace)
+		if end < 0 {
+			end = len(s) - n
+		}
+		h.delimiter = s[n : n+end]
+		n += end
+	}
+	if h.delimiter == "" {
+		return heredoc{}, 0, errors.New("heredoc delimiter is empty")
+	}
+	return h, n, nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\v' || r == '\f'
+}
+
+func (r *Runner) tokenise(inst instruction, args []string, s *scope) ([]string, error) {
+	argVars := make(map[string]string)
+	argsQuoted := make([]string, len(args))
+	for i, arg := range args {
+		argVars[strconv.Itoa(i+1)] = arg
+		argsQuoted[i] = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+	argVars["@"] = strings.Join(argsQuoted, " ")
+	varMaps := []map[string]string{argVars, s.vars, r.vars}
+	funcs := r.builtinFuncs(s)
+	for name := range funcs {
+		for _, varMap := range varMaps {
+			if _, ok := varMap[name]; ok {
+				delete(funcs, name)
+			}
+		}
+	}
+	e := expander{
+		lookup: func(k string) (string, bool) {
+			for _, varMap := range varMaps {
+				if v, ok := varMap[k]; ok {
+					return v, true
+				}
+			}
+			if v, ok := r.builtinVar(k, s); ok {
+				return v, true
+			}
+			return r.lookupEnv(k, s.env)
+		},
+		funcs: funcs,
+	}
+	text, err := e.expand(inst.text)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := splitTokens(text)
+	if err != nil {
+		return nil, err
+	}
+	for i, token := range tokens {
+		indexStr, found := strings.CutPrefix(token, heredocSentinel)
+		if !found {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(indexStr, heredocSentinel))
+		if err != nil || index >= len(inst.heredocs) {
+			continue
+		}
+		h := inst.heredocs[index]
+		tokens[i] = h.body
+		if h.expand {
+			if tokens[i], err = e.expand(h.body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func splitTokens(s string) ([]string, error) {
+	var tokens []string
+	var currentToken strings.Builder
+	var forceAppend bool
+	appendCurrentToken := func() {
+		if currentToken.Len() > 0 || forceAppend {
+			tokens = append(tokens, currentToken.String())
+			currentToken.Reset()
+			forceAppend = false
+		}
+	}
+	var escaped, inSingleQuote, inDoubleQuote bool
+	for _, char := range s {
+		if escaped {
+			escaped = false
+			if char == '\\' || char == '\'' || char == '"' {
+				currentToken.WriteRune(char)
+				continue
+			}
+			currentToken.WriteRune('\\')
+		}
+		switch {
+		case char == '\\':
+			escaped = true
+		case char == '\'':
+			if inDoubleQuote {
+				currentToken.WriteRune(char)
+			} else {
+				inSingleQuote = !inSingleQuote
+			}
+			forceAppend = true
+		case char == '"':
+			if inSingleQuote {
+				currentToken.WriteRune(char)
+			} else {
+				inDoubleQuote = !inDoubleQuote
+			}
+			forceAppend = true
+		case isSpace(char):
+			if inSingleQuote || inDoubleQuote {
+				currentToken.WriteRune(char)
+			} else {
+				appendCurrentToken()
+			}
+		default:
+			currentToken.WriteRune(char)
+		}
+	}
+	if escaped {
+		currentToken.WriteRune('\\')
+	}
+	if inSingleQuote || inDoubleQuote {
+		return nil, errUnterminatedQuote
+	}
+	appendCurrentToken()
+	return tokens, nil
+}
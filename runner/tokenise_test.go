@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"autoshell/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitInstructions(t *testing.T) {
+	r := New(config.Config{})
+	r.vars["db"] = "myapp"
+	instructions, err := splitInstructions(strings.Join([]string{
+		"# comment",
+		"",
+		"runCommand\tcreate-sql-dump   mysqldump \\",
+		"  -u root $db # dump the database",
+		`print "a # b" 'c\'d' D:\Code D:\\`,
+		"runCommand script sh -c <<EOF",
+		"echo $db",
+		"echo done",
+		"EOF",
+		"runCommand literal python3 -c <<-'PY' arg",
+		"\tprint('$db')",
+		"\tPY",
+		"print end",
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("split instructions: %v", err)
+	}
+	expected := [][]string{
+		{"runCommand", "create-sql-dump", "mysqldump", "-u", "root", "myapp"},
+		{"print", "a # b", "c'd", `D:\Code`, `D:\`},
+		{"runCommand", "script", "sh", "-c", "echo myapp\necho done"},
+		{"runCommand", "literal", "python3", "-c", "print('$db')", "arg"},
+		{"print", "end"},
+	}
+	if len(instructions) != len(expected) {
+		t.Fatalf("expected %d instructions, got %d", len(expected), len(instructions))
+	}
+	for i, inst := range instructions {
+		tokens, err := r.tokenise(inst, nil, newRootScope())
+		if err != nil {
+			t.Fatalf("tokenise %q: %v", inst.text, err)
+		}
+		if !slices.Equal(tokens, expected[i]) {
+			t.Errorf("expected instruction %d to be tokenised as %q, got %q", i, expected[i], tokens)
+		}
+	}
+	if lines := []int{instructions[0].line, instructions[1].line, instructions[4].line}; !slices.Equal(lines, []int{3, 5, 13}) {
+		t.Errorf("unexpected line numbers %v", lines)
+	}
+	for text, expected := range map[string]string{
+		`print "unterminated`:      "line 1: unterminated quote",
+		"print 'a\nprint b'":       "line 1: unterminated quote",
+		"print a \\":               "line 1: line continuation at end of instructions",
+		"runCommand x sh <<EOF\nx": `line 1: heredoc "EOF" not terminated`,
+	} {
+		if _, err := splitInstructions(text); err == nil || err.Error() != expected {
+			t.Errorf("expected %q to fail with %q, got %v", text, expected, err)
+		}
+	}
+	r.vars["quote"] = `it's`
+	if _, err := r.tokenise(instruction{text: "print $quote"}, nil, newRootScope()); err == nil {
+		t.Error("expected unterminated quote after substitution to fail")
+	}
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type scope struct {
+	vars map[string]string
+	env  map[string]string
+	dirs []string
+}
+
+func newRootScope() *scope {
+	workDir, _ := os.Getwd()
+	return &scope{vars: make(map[string]string), env: make(map[string]string), dirs: []string{workDir}}
+}
+
+func (s *scope) clone() *scope {
+	return &scope{vars: maps.Clone(s.vars), env: maps.Clone(s.env), dirs: slices.Clone(s.dirs)}
+}
+
+func (s *scope) workDir() string {
+	return s.dirs[len(s.dirs)-1]
+}
+
+func (s *scope) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.workDir(), path)
+}
+
+func (s *scope) resolveDir(path string) (string, error) {
+	dir := s.resolvePath(path)
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("stat dir: %w", err)
+	}
+	if !fileInfo.IsDir() {
+		return "", fmt.Errorf("%q is not a directory", dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+func (s *scope) setWorkDir(path string) error {
+	dir, err := s.resolveDir(path)
+	if err != nil {
+		return err
+	}
+	s.dirs[len(s.dirs)-1] = dir
+	return nil
+}
+
+func (s *scope) pushDir(path string) error {
+	dir, err := s.resolveDir(path)
+	if err != nil {
+		return err
+	}
+	s.dirs = append(s.dirs, dir)
+	return nil
+}
+
+func (s *scope) popDir() error {
+	if len(s.dirs) == 1 {
+		return errors.New("directory stack is empty")
+	}
+	s.dirs = s.dirs[:len(s.dirs)-1]
+	return nil
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"autoshell/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, subDir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, subDir), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "name"), []byte("alpha\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	r := New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setWorkDir " + filepath.ToSlash(dir),
+			"pushDir a",
+			"setVarFromFile name name",
+			"runShell shell 'echo shell $$PWD'",
+			"runShell!dir=../b modifier 'echo modifier $$PWD'",
+			"runWorkflow nested",
+			"print main $workDir $name",
+			"popDir",
+			"print popped $workDir",
+			"popDir",
+		}, "\n")},
+		"nested": {Instructions: strings.Join([]string{
+			"setWorkDir ../b",
+			"print nested $workDir",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Fatal("expected popping the last directory to fail")
+	}
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	log := r.logTail.String()
+	for _, expected := range []string{"popDir: directory stack is empty\n", "shell " + a + "\n", "modifier " + b + "\n", "nested " + b + "\n", "main " + a + " alpha\n", "popped " + dir + "\n"} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected log to contain %q, got %q", expected, log)
+		}
+	}
+	if wd, _ := os.Getwd(); wd == dir || wd == a || wd == b {
+		t.Errorf("expected process working directory to be unchanged, got %q", wd)
+	}
+	r = New(config.Config{Workflows: map[string]config.Workflow{"main": {Instructions: "setWorkDir " + filepath.ToSlash(filepath.Join(dir, "missing"))}}})
+	if err := r.RunWorkflow([]string{"main"}); err == nil {
+		t.Error("expected missing directory to fail")
+	}
+	r = New(config.Config{Workflows: map[string]config.Workflow{
+		"main": {Instructions: strings.Join([]string{
+			"setWorkDir " + filepath.ToSlash(a),
+			"setLogFile run.log",
+			"addReporter json report.json",
+			"addReporter!stateFile=state.json,notify=change ntfy http://127.0.0.1:0",
+			"print hello",
+		}, "\n")},
+	}})
+	if err := r.RunWorkflow([]string{"main"}); err != nil {
+		t.Fatalf("run workflow: %v", err)
+	}
+	for _, name := range []string{"run.log", "report.json"} {
+		if _, err := os.Stat(filepath.Join(a, name)); err != nil {
+			t.Errorf("expected %s to be written to the working directory: %v", name, err)
+		}
+	}
+	if chat, ok := r.reporters[1].reporter.(*chatReporter); !ok || chat.notify.stateFilePath != filepath.Join(a, "state.json") {
+		t.Errorf("expected state file to be resolved against the working directory, got %+v", r.reporters[1].reporter)
+	}
+}